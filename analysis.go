@@ -0,0 +1,217 @@
+package lox
+
+import "sort"
+
+// SymbolKind is the kind of declaration of a Symbol.
+type SymbolKind int
+
+const (
+	VariableSymbol SymbolKind = iota
+	FunctionSymbol
+	ClassSymbol
+	ParameterSymbol
+	ImportSymbol
+)
+
+// Symbol is a variable declared in the code, for tools such as editors.
+type Symbol struct {
+	Name string
+	Kind SymbolKind
+	// Token is the name of the symbol in its declaration.
+	Token *Token
+	// Params are the parameters of a function, or of the initializer of a
+	// class.
+	Params []string
+	// Global is set for the declarations at the top level.
+	Global bool
+
+	// scopeStart and scopeEnd are the byte offsets of the code where a local
+	// symbol is visible.
+	scopeStart int
+	scopeEnd   int
+}
+
+// Reference is a use of a variable.
+type Reference struct {
+	Token *Token
+	// Symbol is the declaration of the variable, or nil if it is not declared
+	// in the code, e.g. for built-in functions.
+	Symbol *Symbol
+}
+
+// Analysis is the result of the static analysis of a file: its diagnostics,
+// the symbols it declares and the references to them.
+type Analysis struct {
+	Diagnostics Diagnostics
+	// Symbols are sorted by their position in the code.
+	Symbols    []*Symbol
+	References []*Reference
+}
+
+// Analyze scans, parses and resolves the source code. Unlike Eval, it keeps
+// going after syntax errors, analyzing the declarations that could be parsed.
+func Analyze(filename string, source string) *Analysis {
+	tokens, diagnostics := NewFileScanner(filename, source).ScanTokens()
+	statements, parseDiagnostics := NewParser(tokens).Parse()
+	analysis := &Analysis{Diagnostics: append(diagnostics, parseDiagnostics...)}
+
+	resolver := NewResolver()
+	resolver.analysis = analysis
+	analysis.Diagnostics = append(analysis.Diagnostics, resolver.Resolve(statements)...)
+
+	globals := make(map[string]*Symbol)
+	for _, symbol := range analysis.Symbols {
+		if _, ok := globals[symbol.Name]; symbol.Global && !ok {
+			globals[symbol.Name] = symbol
+		}
+	}
+	for _, reference := range analysis.References {
+		if reference.Symbol == nil {
+			reference.Symbol = globals[reference.Token.lexeme]
+		}
+	}
+
+	sort.SliceStable(analysis.Symbols, func(i, j int) bool {
+		return analysis.Symbols[i].Token.offset < analysis.Symbols[j].Token.offset
+	})
+	setScopes(analysis.Symbols, tokens)
+	return analysis
+}
+
+// setScopes computes the code where each local symbol is visible: the block
+// where it is declared, or the body of the function or catch clause for
+// parameters and caught errors.
+func setScopes(symbols []*Symbol, tokens []*Token) {
+	type block struct{ start, end int }
+	var blocks, open []block
+	for _, token := range tokens {
+		switch token.kind {
+		case LEFT_BRACE:
+			open = append(open, block{start: token.offset})
+		case RIGHT_BRACE:
+			if len(open) > 0 {
+				b := open[len(open)-1]
+				open = open[:len(open)-1]
+				b.end = token.end
+				blocks = append(blocks, b)
+			}
+		}
+	}
+	// Unclosed blocks go until the end of the code.
+	for _, b := range open {
+		b.end = tokens[len(tokens)-1].end
+		blocks = append(blocks, b)
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].start < blocks[j].start })
+
+	for _, symbol := range symbols {
+		if symbol.Global {
+			continue
+		}
+		offset := symbol.Token.offset
+		if symbol.Kind == ParameterSymbol {
+			// The first block after the parameter is the body.
+			k := sort.Search(len(blocks), func(k int) bool { return blocks[k].start > offset })
+			if k < len(blocks) {
+				symbol.scopeStart, symbol.scopeEnd = offset, blocks[k].end
+			}
+			continue
+		}
+		// The innermost block containing the declaration is the last one
+		// that starts before it and has not ended.
+		for _, b := range blocks {
+			if b.start > offset {
+				break
+			}
+			if b.end > offset {
+				symbol.scopeStart, symbol.scopeEnd = offset, b.end
+			}
+		}
+	}
+}
+
+// SymbolAt returns the symbol declared or referenced at the given byte offset
+// of the code, or nil if there is none.
+func (a *Analysis) SymbolAt(offset int) *Symbol {
+	for _, symbol := range a.Symbols {
+		if symbol.Token.offset <= offset && offset <= symbol.Token.end {
+			return symbol
+		}
+	}
+	for _, reference := range a.References {
+		if reference.Token.offset <= offset && offset <= reference.Token.end {
+			return reference.Symbol
+		}
+	}
+	return nil
+}
+
+// ReferencesTo returns the tokens where the symbol is used, in the order they
+// appear in the code.
+func (a *Analysis) ReferencesTo(symbol *Symbol) []*Token {
+	var tokens []*Token
+	for _, reference := range a.References {
+		if reference.Symbol == symbol {
+			tokens = append(tokens, reference.Token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].offset < tokens[j].offset })
+	return tokens
+}
+
+// InScope returns the symbols that are visible at the given byte offset of
+// the code, sorted by name. When several symbols have the same name, only the
+// innermost one is returned.
+func (a *Analysis) InScope(offset int) []*Symbol {
+	byName := make(map[string]*Symbol)
+	for _, symbol := range a.Symbols {
+		visible := symbol.Global ||
+			(symbol.scopeStart < offset && offset <= symbol.scopeEnd)
+		if !visible {
+			continue
+		}
+		// Symbols are sorted by position, so later ones are inner ones.
+		if previous, ok := byName[symbol.Name]; !ok || previous.Global || !symbol.Global {
+			byName[symbol.Name] = symbol
+		}
+	}
+
+	symbols := make([]*Symbol, 0, len(byName))
+	for _, symbol := range byName {
+		symbols = append(symbols, symbol)
+	}
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i].Name < symbols[j].Name })
+	return symbols
+}
+
+func (r *Resolver) addSymbol(name *Token, kind SymbolKind, params []*Token) {
+	if r.analysis == nil || name == nil {
+		return
+	}
+	symbol := &Symbol{Name: name.lexeme, Kind: kind, Token: name, Global: len(r.scopes) == 0}
+	for _, param := range params {
+		symbol.Params = append(symbol.Params, param.lexeme)
+	}
+	r.analysis.Symbols = append(r.analysis.Symbols, symbol)
+	if len(r.scopes) > 0 {
+		if variable, ok := r.scopes[len(r.scopes)-1][name.lexeme]; ok && variable.symbol == nil {
+			variable.symbol = symbol
+		}
+	}
+}
+
+func (r *Resolver) addReference(name *Token) {
+	if r.analysis == nil {
+		return
+	}
+	reference := &Reference{Token: name}
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if variable, ok := r.scopes[i][name.lexeme]; ok {
+			reference.Symbol = variable.symbol
+			break
+		}
+	}
+	// References to globals are resolved once all the declarations are
+	// known.
+	r.analysis.References = append(r.analysis.References, reference)
+}
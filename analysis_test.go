@@ -0,0 +1,104 @@
+package lox
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func symbolNames(symbols []*Symbol) []string {
+	var names []string
+	for _, symbol := range symbols {
+		names = append(names, symbol.Name)
+	}
+	return names
+}
+
+func TestAnalyzeResolvesReferences(t *testing.T) {
+	source := `var a = 1;
+fun add(a, b) {
+  return a + b;
+}
+class Point {
+  init(x, y) {}
+}
+print add(a, 2);
+a = Point;
+`
+	analysis := Analyze("", source)
+	require.Nil(t, analysis.Diagnostics)
+	require.Equal(t, []string{"a", "add", "a", "b", "Point", "x", "y"}, symbolNames(analysis.Symbols))
+
+	global := analysis.Symbols[0]
+	require.True(t, global.Global)
+	param := analysis.Symbols[2]
+	require.Equal(t, ParameterSymbol, param.Kind)
+	require.False(t, param.Global)
+
+	// The parameter shadows the global inside the function.
+	inner := strings.Index(source, "a + b")
+	require.Same(t, param, analysis.SymbolAt(inner))
+	require.Equal(t, []*Token{analysis.References[0].Token}, analysis.ReferencesTo(param))
+
+	outer := strings.Index(source, "add(a, 2)") + len("add(")
+	require.Same(t, global, analysis.SymbolAt(outer))
+	references := analysis.ReferencesTo(global)
+	require.Len(t, references, 2)
+	require.Equal(t, outer, references[0].Offset())
+	require.Equal(t, strings.Index(source, "a = Point"), references[1].Offset())
+
+	require.Equal(t, []string{"a", "b"}, analysis.Symbols[1].Params)
+	require.Equal(t, []string{"x", "y"}, analysis.Symbols[4].Params)
+	require.Nil(t, analysis.SymbolAt(strings.Index(source, "print")))
+}
+
+func TestAnalyzeInScope(t *testing.T) {
+	source := `var g;
+fun f(p) {
+  var local;
+  {
+    var block;
+  }
+  try {} catch (e) {
+    print e;
+  }
+  return p;
+}
+var late;
+`
+	analysis := Analyze("", source)
+	require.False(t, analysis.Diagnostics.HasErrors())
+	var warnings []string
+	for _, d := range analysis.Diagnostics {
+		require.Equal(t, SeverityWarning, d.Severity)
+		warnings = append(warnings, d.Error())
+	}
+	require.Equal(t, []string{
+		"[line 5] Warning at 'block': Local variable 'block' is never used.",
+		"[line 3] Warning at 'local': Local variable 'local' is never used.",
+	}, warnings)
+
+	inScope := func(before string) []string {
+		return symbolNames(analysis.InScope(strings.Index(source, before)))
+	}
+	require.Equal(t, []string{"f", "g", "late", "local", "p"}, inScope("return"))
+	require.Equal(t, []string{"block", "f", "g", "late", "local", "p"}, inScope("  }\n  try"))
+	require.Equal(t, []string{"e", "f", "g", "late", "local", "p"}, inScope("print e"))
+	require.Equal(t, []string{"f", "g", "late"}, inScope("var late"))
+}
+
+func TestAnalyzeKeepsGoingAfterSyntaxErrors(t *testing.T) {
+	source := `fun f(x) {
+  print x +;
+  return x;
+}
+var y = ;
+var z = f(1);
+`
+	analysis := Analyze("test.lox", source)
+	require.Len(t, analysis.Diagnostics, 2)
+	require.Equal(t, []string{"f", "x", "z"}, symbolNames(analysis.Symbols))
+	require.Len(t, analysis.ReferencesTo(analysis.Symbols[0]), 1)
+	require.Len(t, analysis.ReferencesTo(analysis.Symbols[1]), 1)
+}
@@ -1,43 +1,109 @@
-// +build ignore
-
 package lox
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
+// astPrinter prints expressions in prefix notation. It is built with the
+// package since the REPL's :ast command shows the syntax tree of expressions,
+// and assert statements use it when the source text is not available.
 type astPrinter struct {
 }
 
+// ExprToString returns the syntax tree of the expression in prefix notation,
+// e.g. "(* (- 123) (group 45.67))".
 func ExprToString(e Expr) string {
 	a := astPrinter{}
 	return e.accept(a).(string)
 }
 
+func (a astPrinter) visitAssignExpr(e *Assign) interface{} {
+	return a.parenthesize("=", NewVariable(e.name), e.value)
+}
+
 func (a astPrinter) visitBinaryExpr(b *Binary) interface{} {
 	return a.parenthesize(b.operator.lexeme, b.left, b.right)
 }
 
+func (a astPrinter) visitCallExpr(e *Call) interface{} {
+	return a.parenthesize("call", append([]Expr{e.callee}, e.arguments...)...)
+}
+
+func (a astPrinter) visitGetExpr(e *Get) interface{} {
+	return a.parenthesize(".", e.object, NewVariable(e.name))
+}
+
 func (a astPrinter) visitGroupingExpr(g *Grouping) interface{} {
 	return a.parenthesize("group", g.expression)
 }
 
+func (a astPrinter) visitIndexExpr(e *Index) interface{} {
+	return a.parenthesize("[]", e.object, e.index)
+}
+
+func (a astPrinter) visitLambdaExpr(e *Lambda) interface{} {
+	params := make([]string, len(e.declaration.params))
+	for k, param := range e.declaration.params {
+		params[k] = param.lexeme
+	}
+	return "(fun (" + strings.Join(params, " ") + ") ...)"
+}
+
+func (a astPrinter) visitListExpr(e *List) interface{} {
+	return a.parenthesize("list", e.elements...)
+}
+
 func (a astPrinter) visitLiteralExpr(l *Literal) interface{} {
-	if l.value == nil {
+	switch value := l.value.(type) {
+	case nil:
 		return "nil"
+	case string:
+		return "\"" + value + "\""
 	}
 	return fmt.Sprintf("%v", l.value)
 }
 
+func (a astPrinter) visitLogicalExpr(e *Logical) interface{} {
+	return a.parenthesize(e.operator.lexeme, e.left, e.right)
+}
+
+func (a astPrinter) visitMapExpr(e *Map) interface{} {
+	var exprs []Expr
+	for k := range e.keys {
+		exprs = append(exprs, e.keys[k], e.values[k])
+	}
+	return a.parenthesize("map", exprs...)
+}
+
+func (a astPrinter) visitSetExpr(e *Set) interface{} {
+	return a.parenthesize("=", NewGet(e.object, e.name), e.value)
+}
+
+func (a astPrinter) visitSetIndexExpr(e *SetIndex) interface{} {
+	return a.parenthesize("=", NewIndex(e.object, e.bracket, e.index), e.value)
+}
+
+func (a astPrinter) visitSuperExpr(e *Super) interface{} {
+	return "(super " + e.method.lexeme + ")"
+}
+
+func (a astPrinter) visitThisExpr(e *This) interface{} {
+	return "this"
+}
+
 func (a astPrinter) visitUnaryExpr(u *Unary) interface{} {
 	return a.parenthesize(u.operator.lexeme, u.right)
 }
 
+func (a astPrinter) visitVariableExpr(e *Variable) interface{} {
+	return e.name.lexeme
+}
+
 func (a astPrinter) parenthesize(name string, exprs ...Expr) string {
 	s := "(" + name
 	for _, expr := range exprs {
-		s += " "
-		aa := astPrinter{}
-		ss := expr.accept(aa).(string)
-		s += ss
+		s += " " + expr.accept(a).(string)
 	}
 	s += ")"
 	return s
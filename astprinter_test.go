@@ -1,5 +1,3 @@
-// +build ignore
-
 package lox
 
 import (
@@ -22,3 +20,18 @@ func TestAstPrinter(t *testing.T) {
 
 	require.Equal(t, "(* (- 123) (group 45.67))", ExprToString(expression))
 }
+
+func TestAstPrinterParsedExpression(t *testing.T) {
+	tokens, _ := NewScanner(`a.b = f(1, "two")[0] or !this.c and [nil, {true: -x}]`).ScanTokens()
+	expression, diagnostics := NewParser(tokens).ParseExpression()
+	require.Nil(t, diagnostics)
+	require.Equal(t,
+		`(= (. a b) (or ([] (call f 1 "two") 0) (and (! (. this c)) (list nil (map true (- x))))))`,
+		ExprToString(expression),
+	)
+
+	tokens, _ = NewScanner("1 + 2; 3").ScanTokens()
+	expression, diagnostics = NewParser(tokens).ParseExpression()
+	require.Nil(t, expression)
+	require.EqualError(t, diagnostics, "[line 1] Error at ';': Expect end of expression.")
+}
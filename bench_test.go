@@ -0,0 +1,59 @@
+package lox
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+const fibSource = `
+fun fib(n) {
+  if (n < 2) return n;
+  return fib(n - 2) + fib(n - 1);
+}
+fib(20);
+`
+
+const closuresSource = `
+fun makeCounter() {
+  var count = 0;
+  fun increment(by) {
+    count = count + by;
+    return count;
+  }
+  return increment;
+}
+
+var total = 0;
+for (var i = 0; i < 200; i = i + 1) {
+  var counter = makeCounter();
+  for (var j = 0; j < 100; j = j + 1) {
+    total = total + counter(j);
+  }
+}
+total;
+`
+
+func benchmarkScript(b *testing.B, backend Backend, source string) {
+	for n := 0; n < b.N; n++ {
+		i := NewInterpreter(WithBackend(backend), WithStdout(ioutil.Discard))
+		if _, err := i.Eval(source, ""); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFib(b *testing.B) {
+	benchmarkScript(b, TreeWalker, fibSource)
+}
+
+func BenchmarkClosures(b *testing.B) {
+	benchmarkScript(b, TreeWalker, closuresSource)
+}
+
+func BenchmarkFibVM(b *testing.B) {
+	benchmarkScript(b, BytecodeVM, fibSource)
+}
+
+func BenchmarkClosuresVM(b *testing.B) {
+	benchmarkScript(b, BytecodeVM, closuresSource)
+}
@@ -0,0 +1,100 @@
+package lox
+
+import "sort"
+
+// OpCode is an instruction of the bytecode virtual machine.
+//
+// Operands follow the opcode in the chunk: constant indexes, jump offsets and
+// counts take two bytes (big endian), while local slots, upvalue indexes and
+// argument counts take one byte.
+type OpCode byte
+
+const (
+	OP_CONSTANT OpCode = iota // constant
+	OP_NIL
+	OP_TRUE
+	OP_FALSE
+	OP_POP
+	OP_DUP
+	OP_GET_LOCAL     // slot
+	OP_SET_LOCAL     // slot
+	OP_GET_GLOBAL    // name constant
+	OP_DEFINE_GLOBAL // name constant
+	OP_SET_GLOBAL    // name constant
+	OP_GET_UPVALUE   // index
+	OP_SET_UPVALUE   // index
+	OP_GET_PROPERTY  // name constant
+	OP_SET_PROPERTY  // name constant
+	OP_GET_SUPER     // name constant
+	OP_GET_INDEX
+	OP_SET_INDEX
+	OP_EQUAL
+	OP_GREATER
+	OP_GREATER_EQUAL
+	OP_LESS
+	OP_LESS_EQUAL
+	OP_ADD
+	OP_SUBTRACT
+	OP_MULTIPLY
+	OP_DIVIDE
+	OP_NOT
+	OP_NEGATE
+	OP_PRINT
+	OP_JUMP          // offset
+	OP_JUMP_IF_FALSE // offset
+	OP_LOOP          // offset
+	OP_CALL          // argument count
+	OP_CLOSURE       // function constant, followed by (isLocal, index) for each upvalue
+	OP_CLOSE_UPVALUE
+	OP_RETURN
+	OP_CLASS // name constant
+	OP_INHERIT
+	OP_METHOD // name constant
+	OP_LIST   // element count
+	OP_MAP    // entry count
+	OP_THROW
+	OP_ASSERTION_FAILED // source text constant
+	OP_RETHROW
+	OP_PUSH_HANDLER // offset of the handler
+	OP_POP_HANDLER
+	OP_ERROR_VALUE
+	OP_IMPORT      // path constant
+	OP_IMPORT_NAME // path constant, name constant
+)
+
+// Chunk is a compiled sequence of bytecode instructions.
+type Chunk struct {
+	code      []byte
+	constants []interface{}
+	// lines maps ranges of instructions to the token they were compiled
+	// from, for error reporting. It is sorted by offset, and each entry
+	// applies until the next one.
+	lines []lineStart
+}
+
+type lineStart struct {
+	offset int
+	token  *Token
+}
+
+func (c *Chunk) write(b byte, token *Token) {
+	if n := len(c.lines); n == 0 || c.lines[n-1].token != token {
+		c.lines = append(c.lines, lineStart{len(c.code), token})
+	}
+	c.code = append(c.code, b)
+}
+
+func (c *Chunk) addConstant(value interface{}) int {
+	c.constants = append(c.constants, value)
+	return len(c.constants) - 1
+}
+
+// tokenAt returns the token that the instruction at the given offset was
+// compiled from.
+func (c *Chunk) tokenAt(offset int) *Token {
+	k := sort.Search(len(c.lines), func(k int) bool { return c.lines[k].offset > offset })
+	if k == 0 {
+		return nil
+	}
+	return c.lines[k-1].token
+}
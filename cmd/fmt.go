@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/dessaya/lox"
+)
+
+// fmtMain runs the fmt command and returns the exit status.
+func fmtMain(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	check := flags.Bool("check", false, "list the files that are not formatted, and exit with status 1 if there are any")
+	write := flags.Bool("w", false, "write the result to the file instead of the standard output")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: jlox fmt [-check] [-w] file...\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 64
+	}
+
+	status := 0
+	for _, path := range flags.Args() {
+		source := loadFile(path)
+		formatted, diagnostics := lox.Format(path, source)
+		if diagnostics.HasErrors() {
+			fmt.Fprint(os.Stderr, diagnostics.Render())
+			status = 65
+			continue
+		}
+
+		switch {
+		case *check:
+			if formatted != source {
+				fmt.Println(path)
+				if status == 0 {
+					status = 1
+				}
+			}
+		case *write:
+			if formatted != source {
+				if err := ioutil.WriteFile(path, []byte(formatted), 0666); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					status = 1
+				}
+			}
+		default:
+			fmt.Print(formatted)
+		}
+	}
+	return status
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// errInterrupted is returned by readLine when the user presses Ctrl-C.
+var errInterrupted = errors.New("interrupted")
+
+// maxHistory is the number of lines kept in the history.
+const maxHistory = 1000
+
+// lineEditor reads lines typed in a terminal, which can be edited with the
+// arrow keys and the usual Emacs-style control keys, and recalled later from
+// the history.
+type lineEditor struct {
+	in  *bufio.Reader
+	out io.Writer
+	// fd is the file descriptor of the terminal, or -1 if the input is not a
+	// terminal, in which case lines are read without editing.
+	fd int
+
+	history []string
+	// historyFile is where the history is saved, or "" if it is not.
+	historyFile string
+}
+
+func newLineEditor(in *os.File, out io.Writer) *lineEditor {
+	e := &lineEditor{in: bufio.NewReader(in), out: out, fd: -1}
+	if isTerminal(int(in.Fd())) {
+		e.fd = int(in.Fd())
+	}
+	return e
+}
+
+// loadHistory reads the history from the file, where the lines read from
+// now on are saved.
+func (e *lineEditor) loadHistory(path string) {
+	e.historyFile = path
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	e.history = strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+}
+
+// historyPath returns the path of the history file: $LOX_HISTORY, or
+// .lox_history in the home directory.
+func historyPath() string {
+	if path := os.Getenv("LOX_HISTORY"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".lox_history")
+}
+
+func (e *lineEditor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+	e.history = append(e.history, line)
+	if e.historyFile == "" {
+		return
+	}
+	f, err := os.OpenFile(e.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(f, line)
+	f.Close()
+}
+
+// readLine prints the prompt and reads a line, without the line terminator.
+// It returns io.EOF at the end of the input, or if the user presses Ctrl-D
+// on an empty line.
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	if e.fd >= 0 {
+		if restore, err := makeRaw(e.fd); err == nil {
+			defer restore()
+			return e.edit(prompt)
+		}
+	}
+
+	fmt.Fprint(e.out, prompt)
+	line, err := e.in.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// edit reads the keys pressed by the user, with the terminal in raw mode,
+// until Enter.
+func (e *lineEditor) edit(prompt string) (string, error) {
+	var buf []rune
+	pos := 0
+	// browsing is the index of the history entry being shown, and pending
+	// the line that was being typed before browsing.
+	browsing := len(e.history)
+	var pending []rune
+
+	refresh := func() {
+		s := "\r" + prompt + string(buf) + "\x1b[K"
+		if pos < len(buf) {
+			s += fmt.Sprintf("\x1b[%dD", len(buf)-pos)
+		}
+		io.WriteString(e.out, s)
+	}
+	recall := func(k int) {
+		if k < 0 || k > len(e.history) {
+			return
+		}
+		if browsing == len(e.history) {
+			pending = buf
+		}
+		browsing = k
+		if k == len(e.history) {
+			buf = pending
+		} else {
+			buf = []rune(e.history[k])
+		}
+		pos = len(buf)
+	}
+
+	io.WriteString(e.out, prompt)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			if err == io.EOF && len(buf) > 0 {
+				err = nil
+			}
+			io.WriteString(e.out, "\r\n")
+			return string(buf), err
+		}
+
+		switch r {
+		case '\r', '\n':
+			io.WriteString(e.out, "\r\n")
+			line := string(buf)
+			e.addHistory(line)
+			return line, nil
+		case 3: // Ctrl-C
+			io.WriteString(e.out, "^C\r\n")
+			return "", errInterrupted
+		case 4: // Ctrl-D
+			if len(buf) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case 127, 8: // Backspace
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+			}
+		case 1: // Ctrl-A
+			pos = 0
+		case 5: // Ctrl-E
+			pos = len(buf)
+		case 2: // Ctrl-B
+			if pos > 0 {
+				pos--
+			}
+		case 6: // Ctrl-F
+			if pos < len(buf) {
+				pos++
+			}
+		case 11: // Ctrl-K
+			buf = buf[:pos]
+		case 21: // Ctrl-U
+			buf, pos = append([]rune{}, buf[pos:]...), 0
+		case 23: // Ctrl-W
+			start := pos
+			for start > 0 && unicode.IsSpace(buf[start-1]) {
+				start--
+			}
+			for start > 0 && !unicode.IsSpace(buf[start-1]) {
+				start--
+			}
+			buf, pos = append(buf[:start], buf[pos:]...), start
+		case 12: // Ctrl-L
+			io.WriteString(e.out, "\x1b[H\x1b[2J")
+		case 16: // Ctrl-P
+			recall(browsing - 1)
+		case 14: // Ctrl-N
+			recall(browsing + 1)
+		case 27: // Escape sequences, sent by the arrow keys among others.
+			switch e.escape() {
+			case "[A", "OA":
+				recall(browsing - 1)
+			case "[B", "OB":
+				recall(browsing + 1)
+			case "[C", "OC":
+				if pos < len(buf) {
+					pos++
+				}
+			case "[D", "OD":
+				if pos > 0 {
+					pos--
+				}
+			case "[H", "OH", "[1~", "[7~":
+				pos = 0
+			case "[F", "OF", "[4~", "[8~":
+				pos = len(buf)
+			case "[3~":
+				if pos < len(buf) {
+					buf = append(buf[:pos], buf[pos+1:]...)
+				}
+			}
+		default:
+			if unicode.IsPrint(r) {
+				buf = append(buf[:pos], append([]rune{r}, buf[pos:]...)...)
+				pos++
+			}
+		}
+		refresh()
+	}
+}
+
+// escape reads the rest of an escape sequence, after the escape character.
+func (e *lineEditor) escape() string {
+	r, _, err := e.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return ""
+	}
+	seq := string(r)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return seq
+		}
+		seq += string(r)
+		// The sequence ends with a letter or a tilde.
+		if r == '~' || unicode.IsLetter(r) {
+			return seq
+		}
+	}
+}
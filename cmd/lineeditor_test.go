@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func editor(keys string) *lineEditor {
+	return &lineEditor{in: bufio.NewReader(strings.NewReader(keys)), out: ioutil.Discard, fd: -1}
+}
+
+func TestLineEditorKeys(t *testing.T) {
+	tests := map[string]string{
+		"print 1;\r":                                        "print 1;",
+		"prnt\x1b[D\x1b[Di\r":                               "print",
+		"ab\x7f\x7fcd\r":                                    "cd",
+		"world\x01hello \r":                                 "hello world",
+		"abc\x01\x1b[3~\x05d\r":                             "bcd",
+		"one two three\x17\x17four\r":                       "one four",
+		"keep drop\x1b[D\x1b[D\x1b[D\x1b[D\x0b\r":           "keep ",
+		"drop keep\x01\x1b[C\x1b[C\x1b[C\x1b[C\x1b[C\x15\r": "keep",
+		"héllo\x02\x02\x02\x02x\r":                          "hxéllo",
+	}
+	for keys, expected := range tests {
+		line, err := editor(keys).edit("> ")
+		require.NoError(t, err)
+		require.Equal(t, expected, line, keys)
+	}
+
+	_, err := editor("abc\x03").edit("> ")
+	require.Equal(t, errInterrupted, err)
+	_, err = editor("\x04").edit("> ")
+	require.Equal(t, io.EOF, err)
+}
+
+func TestLineEditorHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	e := editor("first\rsecond\rsecond\r\x1b[A\x1b[A\r\x10\x10\x10\x0e!\rtyped\x1b[A\x1b[B\r")
+	e.loadHistory(path)
+	var lines []string
+	for {
+		line, err := e.edit("> ")
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		lines = append(lines, line)
+	}
+	require.Equal(t, []string{"first", "second", "second", "first", "second!", "typed"}, lines)
+
+	// Consecutive duplicates are only saved once.
+	e = editor("")
+	e.loadHistory(path)
+	require.Equal(t, []string{"first", "second", "first", "second!", "typed"}, e.history)
+}
@@ -1,22 +1,66 @@
 package main
 
 import (
-	"bufio"
+	"flag"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 
 	"github.com/dessaya/lox"
+	"github.com/dessaya/lox/dap"
+	"github.com/dessaya/lox/lsp"
 )
 
-var interpreter = lox.NewInterpreter()
+var (
+	interpreter *lox.Interpreter
+	// options are those of interpreter, to make new ones.
+	options []lox.Option
+)
 
 func main() {
-	args := os.Args[1:]
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		os.Exit(fmtMain(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "test" {
+		os.Exit(testMain(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "lsp" {
+		if err := lsp.Serve(os.Stdin, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "dap" {
+		if err := dap.Serve(os.Stdin, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	useVM := flag.Bool("vm", false, "run the code on the bytecode virtual machine")
+	optimize := flag.Bool("O", false, "optimize the code before running it")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: jlox [-vm] [-O] [script]\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "       jlox fmt [-check] [-w] file...\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "       jlox test [-vm] [-O] [-parallel N] [-timeout D] [-v] [path...]\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "       jlox lsp\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "       jlox dap\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	backend := lox.TreeWalker
+	if *useVM {
+		backend = lox.BytecodeVM
+	}
+	options = []lox.Option{lox.WithBackend(backend), lox.WithOptimizer(*optimize)}
+	interpreter = newInterpreter()
+
+	args := flag.Args()
 	if len(args) > 1 {
-		fmt.Printf("Usage: jlox [script]\n")
+		flag.Usage()
 		os.Exit(64)
 	} else if len(args) == 1 {
 		runFile(args[0])
@@ -25,6 +69,14 @@ func main() {
 	}
 }
 
+func newInterpreter() *lox.Interpreter {
+	i := lox.NewInterpreter(options...)
+	if path := os.Getenv("LOX_PATH"); path != "" {
+		i.SetSearchPath(filepath.SplitList(path))
+	}
+	return i
+}
+
 func loadFile(path string) string {
 	file, err := os.Open(path)
 	if err != nil {
@@ -40,50 +92,24 @@ func loadFile(path string) string {
 }
 
 func runFile(path string) {
-	run(loadFile(path))
-	if lox.HadError {
-		os.Exit(65)
-	}
-	if lox.HadRuntimeError {
-		os.Exit(70)
-	}
-}
-
-func runPrompt() {
-	reader := bufio.NewReader(os.Stdin)
-	for {
-		fmt.Printf("> ")
-		line, err := reader.ReadString('\n')
-		if err != nil && err != io.EOF {
-			log.Fatal(err)
-		}
-		run(line)
-		lox.HadError = false
-		if err == io.EOF {
-			break
-		}
+	interpreter.SetScriptPath(path)
+	if code := run(path, loadFile(path)); code != 0 {
+		os.Exit(code)
 	}
 }
 
-func run(source string) {
-	scanner := lox.NewScanner(source)
-	tokens := scanner.ScanTokens()
-
-	parser := lox.NewParser(tokens)
-	statements := parser.Parse()
-
-	// Stop if there was a syntax error.
-	if lox.HadError {
-		return
+// run executes the source code and returns the exit status: 65 if there was
+// a compile error, 70 if there was a runtime error, and 0 otherwise.
+func run(filename string, source string) int {
+	_, err := interpreter.Eval(source, filename)
+	if err != nil {
+		interpreter.Report(err)
 	}
-
-	resolver := lox.NewResolver(interpreter)
-	resolver.Resolve(statements)
-
-	// Stop if there was a resolution error.
-	if lox.HadError {
-		return
+	switch err.(type) {
+	case lox.Diagnostics:
+		return 65
+	case lox.RuntimeError:
+		return 70
 	}
-
-	interpreter.Interpret(statements)
+	return 0
 }
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/dessaya/lox"
+)
+
+const replHelp = `Type Lox code to run it. The value of an expression is printed, and the
+final semicolon may be omitted. Commands:
+  :env        list the global variables
+  :load FILE  run a file in this session
+  :ast EXPR   show the syntax tree of an expression
+  :reset      start a new session, forgetting all variables
+  :help       show this help
+  :quit       exit (or press Ctrl-D)
+`
+
+func runPrompt() {
+	editor := newLineEditor(os.Stdin, os.Stdout)
+	if path := historyPath(); path != "" {
+		editor.loadHistory(path)
+	}
+
+	for {
+		source, err := readInput(editor)
+		if err == errInterrupted {
+			continue
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(74)
+		}
+
+		if command := strings.TrimSpace(source); strings.HasPrefix(command, ":") {
+			if !runCommand(command) {
+				break
+			}
+			continue
+		}
+		evalInput(source)
+	}
+}
+
+// readInput reads lines until they form a command, or code with balanced
+// brackets.
+func readInput(editor *lineEditor) (string, error) {
+	source, prompt := "", "> "
+	for {
+		line, err := editor.readLine(prompt)
+		if err == io.EOF && source != "" {
+			return source, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		source += line + "\n"
+		if strings.HasPrefix(strings.TrimSpace(source), ":") || !lox.Incomplete(source) {
+			return source, nil
+		}
+		prompt = "... "
+	}
+}
+
+// evalInput runs the code typed in the prompt and prints its value, if it
+// is an expression. Ctrl-C interrupts the execution.
+func evalInput(source string) {
+	if strings.TrimSpace(source) == "" {
+		return
+	}
+	if !parses(source) && parses(source+";") {
+		source += ";"
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	value, err := interpreter.EvalContext(ctx, source, "")
+	if err != nil {
+		interpreter.Report(err)
+		return
+	}
+	if value != nil {
+		s, _ := lox.Inspect(value)
+		fmt.Println(s)
+	}
+}
+
+// parses reports whether the code is syntactically valid.
+func parses(source string) bool {
+	tokens, diagnostics := lox.NewScanner(source).ScanTokens()
+	if diagnostics.HasErrors() {
+		return false
+	}
+	_, diagnostics = lox.NewParser(tokens).Parse()
+	return !diagnostics.HasErrors()
+}
+
+// runCommand runs a command typed in the prompt, and reports whether the
+// prompt should keep reading input.
+func runCommand(command string) bool {
+	name, arg := command, ""
+	if k := strings.IndexAny(command, " \t\n"); k >= 0 {
+		name, arg = command[:k], strings.TrimSpace(command[k:])
+	}
+
+	switch name {
+	case ":help":
+		fmt.Print(replHelp)
+	case ":quit":
+		return false
+	case ":env":
+		for _, v := range interpreter.Globals() {
+			s, _ := lox.Inspect(v.Value)
+			fmt.Printf("%s = %s\n", v.Name, s)
+		}
+	case ":load":
+		if arg == "" {
+			fmt.Fprintln(os.Stderr, "Usage: :load FILE")
+			break
+		}
+		b, err := ioutil.ReadFile(arg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			break
+		}
+		run(arg, string(b))
+	case ":ast":
+		tokens, diagnostics := lox.NewFileScanner("", arg).ScanTokens()
+		if diagnostics.HasErrors() {
+			interpreter.Report(diagnostics)
+			break
+		}
+		expr, diagnostics := lox.NewParser(tokens).ParseExpression()
+		if diagnostics.HasErrors() {
+			interpreter.Report(diagnostics)
+			break
+		}
+		fmt.Println(lox.ExprToString(expr))
+	case ":reset":
+		interpreter = newInterpreter()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %s. Type :help for the list of commands.\n", name)
+	}
+	return true
+}
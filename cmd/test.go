@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dessaya/lox"
+	"github.com/dessaya/lox/loxtest"
+)
+
+// testMain runs the test command and returns the exit status.
+func testMain(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	useVM := flags.Bool("vm", false, "run the tests on the bytecode virtual machine")
+	optimize := flags.Bool("O", false, "optimize the code before running it")
+	parallel := flags.Int("parallel", 0, "number of tests to run at the same time (default: number of CPUs)")
+	timeout := flags.Duration("timeout", 0, "abort each test after this long (default: no timeout)")
+	verbose := flags.Bool("v", false, "list all the tests, not only the failed ones")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: jlox test [-vm] [-O] [-parallel N] [-timeout D] [-v] [path...]\n")
+		fmt.Fprintf(flags.Output(), "Runs the test_* functions of the .lox files that define them, and the other\n")
+		fmt.Fprintf(flags.Output(), "files as golden tests annotated with '// expect: ...' comments.\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := loxtest.Files(paths)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 66
+	}
+
+	backend := lox.TreeWalker
+	if *useVM {
+		backend = lox.BytecodeVM
+	}
+	runner := &loxtest.Runner{
+		Options:  []lox.Option{lox.WithBackend(backend), lox.WithOptimizer(*optimize)},
+		Parallel: *parallel,
+		Timeout:  *timeout,
+	}
+	if path := os.Getenv("LOX_PATH"); path != "" {
+		runner.SearchPath = filepath.SplitList(path)
+	}
+
+	results := runner.Run(files)
+	status := 0
+	for _, result := range results {
+		if !result.Passed() {
+			status = 1
+		}
+		printResult(result, *verbose)
+	}
+	fmt.Println(loxtest.Summary(results))
+	return status
+}
+
+func printResult(result *loxtest.Result, verbose bool) {
+	if result.Passed() {
+		if verbose {
+			fmt.Printf("PASS %s (%.2fs)\n", result.Name, result.Duration.Seconds())
+		}
+		return
+	}
+	label := "FAIL"
+	if result.Error {
+		label = "ERROR"
+	}
+	fmt.Printf("%s %s (%.2fs)\n", label, result.Name, result.Duration.Seconds())
+	for _, failure := range result.Failures {
+		fmt.Printf("    %s\n", strings.ReplaceAll(failure, "\n", "\n    "))
+	}
+}
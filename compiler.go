@@ -0,0 +1,802 @@
+package lox
+
+import "math"
+
+// vmFunction is a function compiled to bytecode.
+type vmFunction struct {
+	name         string
+	arity        int
+	upvalueCount int
+	chunk        Chunk
+	// isScript is true for the top-level code of a script or module.
+	isScript bool
+}
+
+func (f *vmFunction) String() string {
+	if f.isScript {
+		return "<script>"
+	}
+	if f.name == "" {
+		return "<fn>"
+	}
+	return "<fn " + f.name + ">"
+}
+
+type compilerLocal struct {
+	name       string
+	depth      int
+	isCaptured bool
+}
+
+type compilerUpvalue struct {
+	index   int
+	isLocal bool
+}
+
+// loopContext tracks the jumps of the break and continue statements in a
+// loop, to be patched once the loop is compiled.
+type loopContext struct {
+	scopeDepth    int
+	tryDepth      int
+	breakJumps    []int
+	continueJumps []int
+}
+
+// tryContext tracks a try statement whose body, catch or finally clause is
+// being compiled.
+type tryContext struct {
+	// handlers is the number of exception handlers currently pushed by the
+	// try statement.
+	handlers int
+	finally  *Block
+}
+
+// compiler compiles the resolved AST of a function (or the top-level code)
+// to bytecode for the virtual machine. The resolver must have been run first,
+// since the compiler assumes that the program has no static errors.
+type compiler struct {
+	enclosing  *compiler
+	function   *vmFunction
+	kind       FunctionType
+	locals     []compilerLocal
+	upvalues   []compilerUpvalue
+	scopeDepth int
+	loops      []*loopContext
+	tries      []*tryContext
+
+	// token is the token of the code being compiled, recorded in the line
+	// table of the chunk.
+	token       *Token
+	diagnostics *Diagnostics
+}
+
+func newCompiler(enclosing *compiler, kind FunctionType, name string) *compiler {
+	c := &compiler{
+		enclosing: enclosing,
+		function:  &vmFunction{name: name, isScript: kind == NONE},
+		kind:      kind,
+	}
+	if enclosing != nil {
+		c.token = enclosing.token
+		c.diagnostics = enclosing.diagnostics
+	} else {
+		c.diagnostics = &Diagnostics{}
+	}
+
+	// Slot zero holds the function being called, or the instance for
+	// methods.
+	slotZero := ""
+	if kind == METHOD || kind == INITIALIZER {
+		slotZero = "this"
+	}
+	c.locals = append(c.locals, compilerLocal{name: slotZero})
+	return c
+}
+
+// compileScript compiles top-level code. If returnLast is set and the last
+// statement is an expression statement, the compiled function returns its
+// value.
+func compileScript(statements []Stmt, returnLast bool) (*vmFunction, Diagnostics) {
+	c := newCompiler(nil, NONE, "")
+
+	var last Expr
+	if n := len(statements); returnLast && n > 0 {
+		if stmt, ok := statements[n-1].(*Expression); ok {
+			last = stmt.expression
+			statements = statements[:n-1]
+		}
+	}
+
+	for _, statement := range statements {
+		c.compileStmt(statement)
+	}
+	if last != nil {
+		c.compileExpr(last)
+		c.emitOp(OP_RETURN)
+	} else {
+		c.emitReturn()
+	}
+	return c.function, *c.diagnostics
+}
+
+func (c *compiler) compileStmt(stmt Stmt) {
+	stmt.accept(c)
+}
+
+func (c *compiler) compileStmts(statements []Stmt) {
+	for _, statement := range statements {
+		c.compileStmt(statement)
+	}
+}
+
+func (c *compiler) compileExpr(expr Expr) {
+	expr.accept(c)
+}
+
+func (c *compiler) error(message string) {
+	c.diagnostics.errorAt(c.token, message)
+}
+
+func (c *compiler) chunk() *Chunk {
+	return &c.function.chunk
+}
+
+func (c *compiler) emitByte(b byte) {
+	c.chunk().write(b, c.token)
+}
+
+func (c *compiler) emitOp(op OpCode) {
+	c.emitByte(byte(op))
+}
+
+func (c *compiler) emitShort(n int) {
+	c.emitByte(byte(n >> 8))
+	c.emitByte(byte(n))
+}
+
+func (c *compiler) emitOpShort(op OpCode, n int) {
+	c.emitOp(op)
+	c.emitShort(n)
+}
+
+func (c *compiler) emitOpByte(op OpCode, b int) {
+	c.emitOp(op)
+	c.emitByte(byte(b))
+}
+
+func (c *compiler) makeConstant(value interface{}) int {
+	k := c.chunk().addConstant(value)
+	if k > math.MaxUint16 {
+		c.error("Too many constants in one chunk.")
+		return 0
+	}
+	return k
+}
+
+func (c *compiler) emitConstant(value interface{}) {
+	c.emitOpShort(OP_CONSTANT, c.makeConstant(value))
+}
+
+// emitJump emits a jump instruction with a placeholder offset, and returns
+// the position of the offset to be patched.
+func (c *compiler) emitJump(op OpCode) int {
+	c.emitOpShort(op, 0xffff)
+	return len(c.chunk().code) - 2
+}
+
+// patchJump makes the jump at the given position land on the next
+// instruction to be emitted.
+func (c *compiler) patchJump(offset int) {
+	jump := len(c.chunk().code) - offset - 2
+	if jump > math.MaxUint16 {
+		c.error("Too much code to jump over.")
+	}
+	c.chunk().code[offset] = byte(jump >> 8)
+	c.chunk().code[offset+1] = byte(jump)
+}
+
+func (c *compiler) emitLoop(start int) {
+	c.emitOp(OP_LOOP)
+	offset := len(c.chunk().code) - start + 2
+	if offset > math.MaxUint16 {
+		c.error("Loop body too large.")
+	}
+	c.emitShort(offset)
+}
+
+func (c *compiler) emitReturn() {
+	if c.kind == INITIALIZER {
+		c.emitOpByte(OP_GET_LOCAL, 0)
+	} else {
+		c.emitOp(OP_NIL)
+	}
+	c.emitOp(OP_RETURN)
+}
+
+func (c *compiler) beginScope() {
+	c.scopeDepth++
+}
+
+func (c *compiler) endScope() {
+	c.scopeDepth--
+	for len(c.locals) > 0 && c.locals[len(c.locals)-1].depth > c.scopeDepth {
+		c.emitPopLocal(c.locals[len(c.locals)-1])
+		c.locals = c.locals[:len(c.locals)-1]
+	}
+}
+
+func (c *compiler) emitPopLocal(local compilerLocal) {
+	if local.isCaptured {
+		c.emitOp(OP_CLOSE_UPVALUE)
+	} else {
+		c.emitOp(OP_POP)
+	}
+}
+
+// emitPopsTo discards the locals deeper than the given scope depth, without
+// forgetting them, for jumps that leave the scope early.
+func (c *compiler) emitPopsTo(depth int) {
+	for k := len(c.locals) - 1; k >= 0 && c.locals[k].depth > depth; k-- {
+		c.emitPopLocal(c.locals[k])
+	}
+}
+
+// exitTries emits the code that leaves the try statements nested deeper than
+// the given depth: popping their exception handlers and running their finally
+// clauses.
+func (c *compiler) exitTries(depth int) {
+	tries := c.tries
+	for k := len(tries) - 1; k >= depth; k-- {
+		for h := 0; h < tries[k].handlers; h++ {
+			c.emitOp(OP_POP_HANDLER)
+		}
+		if tries[k].finally != nil {
+			// A jump inside the finally clause must not run it again.
+			c.tries = tries[:k]
+			c.compileStmt(tries[k].finally)
+		}
+	}
+	c.tries = tries
+}
+
+// addLocal declares a local variable whose value is already on top of the
+// stack.
+func (c *compiler) addLocal(name string) {
+	if len(c.locals) > math.MaxUint8 {
+		c.error("Too many local variables in function.")
+		return
+	}
+	c.locals = append(c.locals, compilerLocal{name: name, depth: c.scopeDepth})
+}
+
+func (c *compiler) resolveLocal(name string) int {
+	for k := len(c.locals) - 1; k >= 0; k-- {
+		if c.locals[k].name == name {
+			return k
+		}
+	}
+	return -1
+}
+
+func (c *compiler) resolveUpvalue(name string) int {
+	if c.enclosing == nil {
+		return -1
+	}
+	if local := c.enclosing.resolveLocal(name); local >= 0 {
+		c.enclosing.locals[local].isCaptured = true
+		return c.addUpvalue(local, true)
+	}
+	if upvalue := c.enclosing.resolveUpvalue(name); upvalue >= 0 {
+		return c.addUpvalue(upvalue, false)
+	}
+	return -1
+}
+
+func (c *compiler) addUpvalue(index int, isLocal bool) int {
+	for k, upvalue := range c.upvalues {
+		if upvalue.index == index && upvalue.isLocal == isLocal {
+			return k
+		}
+	}
+	if len(c.upvalues) > math.MaxUint8 {
+		c.error("Too many closure variables in function.")
+		return 0
+	}
+	c.upvalues = append(c.upvalues, compilerUpvalue{index, isLocal})
+	c.function.upvalueCount = len(c.upvalues)
+	return len(c.upvalues) - 1
+}
+
+// defineVariable binds the value on top of the stack to a new variable in the
+// current scope.
+func (c *compiler) defineVariable(name *Token) {
+	c.token = name
+	if c.scopeDepth > 0 {
+		c.addLocal(name.lexeme)
+		return
+	}
+	c.emitOpShort(OP_DEFINE_GLOBAL, c.makeConstant(name.lexeme))
+}
+
+func (c *compiler) namedVariable(name *Token) {
+	c.token = name
+	if local := c.resolveLocal(name.lexeme); local >= 0 {
+		c.emitOpByte(OP_GET_LOCAL, local)
+	} else if upvalue := c.resolveUpvalue(name.lexeme); upvalue >= 0 {
+		c.emitOpByte(OP_GET_UPVALUE, upvalue)
+	} else {
+		c.emitOpShort(OP_GET_GLOBAL, c.makeConstant(name.lexeme))
+	}
+}
+
+func (c *compiler) assignVariable(name *Token) {
+	c.token = name
+	if local := c.resolveLocal(name.lexeme); local >= 0 {
+		c.emitOpByte(OP_SET_LOCAL, local)
+	} else if upvalue := c.resolveUpvalue(name.lexeme); upvalue >= 0 {
+		c.emitOpByte(OP_SET_UPVALUE, upvalue)
+	} else {
+		c.emitOpShort(OP_SET_GLOBAL, c.makeConstant(name.lexeme))
+	}
+}
+
+// compileFunction compiles a function declaration and emits the code to
+// create the closure.
+func (c *compiler) compileFunction(declaration *Function, kind FunctionType) {
+	name := ""
+	if declaration.name != nil {
+		name = declaration.name.lexeme
+		c.token = declaration.name
+	}
+
+	fc := newCompiler(c, kind, name)
+	fc.beginScope()
+	for _, param := range declaration.params {
+		fc.function.arity++
+		fc.addLocal(param.lexeme)
+	}
+	fc.compileStmts(declaration.body)
+	fc.emitReturn()
+
+	c.emitOpShort(OP_CLOSURE, c.makeConstant(fc.function))
+	for _, upvalue := range fc.upvalues {
+		if upvalue.isLocal {
+			c.emitByte(1)
+		} else {
+			c.emitByte(0)
+		}
+		c.emitByte(byte(upvalue.index))
+	}
+}
+
+func (c *compiler) visitAssertStmt(stmt *Assert) interface{} {
+	c.compileExpr(stmt.condition)
+	failJump := c.emitJump(OP_JUMP_IF_FALSE)
+	c.emitOp(OP_POP)
+	endJump := c.emitJump(OP_JUMP)
+
+	// The message is only evaluated if the assertion fails.
+	c.patchJump(failJump)
+	c.emitOp(OP_POP)
+	if stmt.message != nil {
+		c.compileExpr(stmt.message)
+	} else {
+		c.emitOp(OP_NIL)
+	}
+	c.token = stmt.keyword
+	c.emitOpShort(OP_ASSERTION_FAILED, c.makeConstant(stmt.text))
+	c.patchJump(endJump)
+	return nil
+}
+
+func (c *compiler) visitBlockStmt(stmt *Block) interface{} {
+	c.beginScope()
+	c.compileStmts(stmt.statements)
+	c.endScope()
+	return nil
+}
+
+func (c *compiler) visitBreakStmt(stmt *Break) interface{} {
+	c.token = stmt.keyword
+	loop := c.loops[len(c.loops)-1]
+	c.exitTries(loop.tryDepth)
+	c.emitPopsTo(loop.scopeDepth)
+	loop.breakJumps = append(loop.breakJumps, c.emitJump(OP_JUMP))
+	return nil
+}
+
+func (c *compiler) visitClassStmt(stmt *Class) interface{} {
+	c.token = stmt.name
+	c.emitOpShort(OP_CLASS, c.makeConstant(stmt.name.lexeme))
+	c.defineVariable(stmt.name)
+
+	if stmt.superclass != nil {
+		c.namedVariable(stmt.superclass.name)
+
+		c.beginScope()
+		c.addLocal("super")
+
+		c.namedVariable(stmt.name)
+		c.token = stmt.superclass.name
+		c.emitOp(OP_INHERIT)
+	}
+
+	c.namedVariable(stmt.name)
+	for _, method := range stmt.methods {
+		kind := METHOD
+		if method.name.lexeme == "init" {
+			kind = INITIALIZER
+		}
+		c.compileFunction(method, kind)
+		c.emitOpShort(OP_METHOD, c.makeConstant(method.name.lexeme))
+	}
+	c.emitOp(OP_POP)
+
+	if stmt.superclass != nil {
+		c.endScope()
+	}
+	return nil
+}
+
+func (c *compiler) visitContinueStmt(stmt *Continue) interface{} {
+	c.token = stmt.keyword
+	loop := c.loops[len(c.loops)-1]
+	c.exitTries(loop.tryDepth)
+	c.emitPopsTo(loop.scopeDepth)
+	loop.continueJumps = append(loop.continueJumps, c.emitJump(OP_JUMP))
+	return nil
+}
+
+func (c *compiler) visitExpressionStmt(stmt *Expression) interface{} {
+	c.compileExpr(stmt.expression)
+	c.emitOp(OP_POP)
+	return nil
+}
+
+func (c *compiler) visitFunctionStmt(stmt *Function) interface{} {
+	if c.scopeDepth > 0 {
+		// Declare the local first, so that the function can refer to itself.
+		c.addLocal(stmt.name.lexeme)
+		c.compileFunction(stmt, FUNCTION)
+		return nil
+	}
+	c.compileFunction(stmt, FUNCTION)
+	c.defineVariable(stmt.name)
+	return nil
+}
+
+func (c *compiler) visitIfStmt(stmt *If) interface{} {
+	c.compileExpr(stmt.condition)
+	thenJump := c.emitJump(OP_JUMP_IF_FALSE)
+	c.emitOp(OP_POP)
+	c.compileStmt(stmt.thenBranch)
+
+	elseJump := c.emitJump(OP_JUMP)
+	c.patchJump(thenJump)
+	c.emitOp(OP_POP)
+	if stmt.elseBranch != nil {
+		c.compileStmt(stmt.elseBranch)
+	}
+	c.patchJump(elseJump)
+	return nil
+}
+
+func (c *compiler) visitImportStmt(stmt *Import) interface{} {
+	path := c.makeConstant(stmt.path)
+	if stmt.name != nil {
+		c.token = stmt.path
+		c.emitOpShort(OP_IMPORT, path)
+		c.defineVariable(stmt.name)
+		return nil
+	}
+	for _, name := range stmt.names {
+		c.token = name
+		c.emitOpShort(OP_IMPORT_NAME, path)
+		c.emitShort(c.makeConstant(name))
+		c.defineVariable(name)
+	}
+	return nil
+}
+
+func (c *compiler) visitPrintStmt(stmt *Print) interface{} {
+	c.compileExpr(stmt.expression)
+	c.emitOp(OP_PRINT)
+	return nil
+}
+
+func (c *compiler) visitReturnStmt(stmt *Return) interface{} {
+	c.token = stmt.keyword
+	if stmt.value != nil {
+		c.compileExpr(stmt.value)
+	} else if c.kind == INITIALIZER {
+		c.emitOpByte(OP_GET_LOCAL, 0)
+	} else {
+		c.emitOp(OP_NIL)
+	}
+
+	if len(c.tries) > 0 {
+		// Keep the return value in a hidden local of its own scope while
+		// running the finally clauses.
+		c.beginScope()
+		c.addLocal("")
+		c.exitTries(0)
+		c.token = stmt.keyword
+		c.emitOp(OP_RETURN)
+		c.endScope()
+		return nil
+	}
+	c.token = stmt.keyword
+	c.emitOp(OP_RETURN)
+	return nil
+}
+
+func (c *compiler) visitThrowStmt(stmt *Throw) interface{} {
+	c.compileExpr(stmt.value)
+	c.token = stmt.keyword
+	c.emitOp(OP_THROW)
+	return nil
+}
+
+func (c *compiler) visitTryStmt(stmt *Try) interface{} {
+	try := &tryContext{finally: stmt.finallyBody}
+
+	var finallyHandler, catchHandler int
+	if stmt.finallyBody != nil {
+		finallyHandler = c.emitJump(OP_PUSH_HANDLER)
+		try.handlers++
+	}
+	if stmt.catchBody != nil {
+		catchHandler = c.emitJump(OP_PUSH_HANDLER)
+		try.handlers++
+	}
+
+	c.tries = append(c.tries, try)
+	c.compileStmt(stmt.body)
+
+	if stmt.catchBody != nil {
+		c.emitOp(OP_POP_HANDLER)
+		try.handlers--
+		skipCatch := c.emitJump(OP_JUMP)
+
+		// The handler finds the error on top of the stack.
+		c.patchJump(catchHandler)
+		c.token = stmt.catchName
+		c.emitOp(OP_ERROR_VALUE)
+		c.beginScope()
+		c.addLocal(stmt.catchName.lexeme)
+		c.compileStmt(stmt.catchBody)
+		c.endScope()
+
+		c.patchJump(skipCatch)
+	}
+	c.tries = c.tries[:len(c.tries)-1]
+
+	if stmt.finallyBody != nil {
+		c.emitOp(OP_POP_HANDLER)
+		c.compileStmt(stmt.finallyBody)
+		end := c.emitJump(OP_JUMP)
+
+		// If an error was raised, run the finally clause and raise it again.
+		// The error is kept in a hidden local of its own scope, which jumps
+		// out of the finally clause discard.
+		c.patchJump(finallyHandler)
+		c.beginScope()
+		c.addLocal("")
+		c.compileStmt(stmt.finallyBody)
+		c.emitOp(OP_RETHROW)
+		c.endScope()
+
+		c.patchJump(end)
+	}
+	return nil
+}
+
+func (c *compiler) visitVarStmt(stmt *Var) interface{} {
+	if stmt.initializer != nil {
+		c.compileExpr(stmt.initializer)
+	} else {
+		c.emitOp(OP_NIL)
+	}
+	c.defineVariable(stmt.name)
+	return nil
+}
+
+func (c *compiler) visitWhileStmt(stmt *While) interface{} {
+	loopStart := len(c.chunk().code)
+	c.compileExpr(stmt.condition)
+	exitJump := c.emitJump(OP_JUMP_IF_FALSE)
+	c.emitOp(OP_POP)
+
+	loop := &loopContext{scopeDepth: c.scopeDepth, tryDepth: len(c.tries)}
+	c.loops = append(c.loops, loop)
+	c.compileStmt(stmt.body)
+	c.loops = c.loops[:len(c.loops)-1]
+
+	for _, jump := range loop.continueJumps {
+		c.patchJump(jump)
+	}
+	if stmt.increment != nil {
+		c.compileExpr(stmt.increment)
+		c.emitOp(OP_POP)
+	}
+	c.emitLoop(loopStart)
+
+	c.patchJump(exitJump)
+	c.emitOp(OP_POP)
+	for _, jump := range loop.breakJumps {
+		c.patchJump(jump)
+	}
+	return nil
+}
+
+func (c *compiler) visitAssignExpr(expr *Assign) interface{} {
+	c.compileExpr(expr.value)
+	c.assignVariable(expr.name)
+	return nil
+}
+
+func (c *compiler) visitBinaryExpr(expr *Binary) interface{} {
+	c.compileExpr(expr.left)
+	c.compileExpr(expr.right)
+	c.token = expr.operator
+	switch expr.operator.kind {
+	case BANG_EQUAL:
+		c.emitOp(OP_EQUAL)
+		c.emitOp(OP_NOT)
+	case EQUAL_EQUAL:
+		c.emitOp(OP_EQUAL)
+	case GREATER:
+		c.emitOp(OP_GREATER)
+	case GREATER_EQUAL:
+		c.emitOp(OP_GREATER_EQUAL)
+	case LESS:
+		c.emitOp(OP_LESS)
+	case LESS_EQUAL:
+		c.emitOp(OP_LESS_EQUAL)
+	case PLUS:
+		c.emitOp(OP_ADD)
+	case MINUS:
+		c.emitOp(OP_SUBTRACT)
+	case STAR:
+		c.emitOp(OP_MULTIPLY)
+	case SLASH:
+		c.emitOp(OP_DIVIDE)
+	}
+	return nil
+}
+
+func (c *compiler) visitCallExpr(expr *Call) interface{} {
+	c.compileExpr(expr.callee)
+	for _, argument := range expr.arguments {
+		c.compileExpr(argument)
+	}
+	c.token = expr.paren
+	c.emitOpByte(OP_CALL, len(expr.arguments))
+	return nil
+}
+
+func (c *compiler) visitGetExpr(expr *Get) interface{} {
+	c.compileExpr(expr.object)
+	c.token = expr.name
+	c.emitOpShort(OP_GET_PROPERTY, c.makeConstant(expr.name.lexeme))
+	return nil
+}
+
+func (c *compiler) visitGroupingExpr(expr *Grouping) interface{} {
+	c.compileExpr(expr.expression)
+	return nil
+}
+
+func (c *compiler) visitIndexExpr(expr *Index) interface{} {
+	c.compileExpr(expr.object)
+	c.compileExpr(expr.index)
+	c.token = expr.bracket
+	c.emitOp(OP_GET_INDEX)
+	return nil
+}
+
+func (c *compiler) visitLambdaExpr(expr *Lambda) interface{} {
+	c.compileFunction(expr.declaration, FUNCTION)
+	return nil
+}
+
+func (c *compiler) visitListExpr(expr *List) interface{} {
+	for _, element := range expr.elements {
+		c.compileExpr(element)
+	}
+	c.token = expr.bracket
+	c.emitOpShort(OP_LIST, len(expr.elements))
+	return nil
+}
+
+func (c *compiler) visitLiteralExpr(expr *Literal) interface{} {
+	switch expr.value {
+	case nil:
+		c.emitOp(OP_NIL)
+	case true:
+		c.emitOp(OP_TRUE)
+	case false:
+		c.emitOp(OP_FALSE)
+	default:
+		c.emitConstant(expr.value)
+	}
+	return nil
+}
+
+func (c *compiler) visitLogicalExpr(expr *Logical) interface{} {
+	c.compileExpr(expr.left)
+	c.token = expr.operator
+	if expr.operator.kind == OR {
+		elseJump := c.emitJump(OP_JUMP_IF_FALSE)
+		endJump := c.emitJump(OP_JUMP)
+		c.patchJump(elseJump)
+		c.emitOp(OP_POP)
+		c.compileExpr(expr.right)
+		c.patchJump(endJump)
+	} else { // AND
+		endJump := c.emitJump(OP_JUMP_IF_FALSE)
+		c.emitOp(OP_POP)
+		c.compileExpr(expr.right)
+		c.patchJump(endJump)
+	}
+	return nil
+}
+
+func (c *compiler) visitMapExpr(expr *Map) interface{} {
+	for k := range expr.keys {
+		c.compileExpr(expr.keys[k])
+		c.compileExpr(expr.values[k])
+	}
+	c.token = expr.brace
+	c.emitOpShort(OP_MAP, len(expr.keys))
+	return nil
+}
+
+func (c *compiler) visitSetExpr(expr *Set) interface{} {
+	c.compileExpr(expr.object)
+	c.compileExpr(expr.value)
+	c.token = expr.name
+	c.emitOpShort(OP_SET_PROPERTY, c.makeConstant(expr.name.lexeme))
+	return nil
+}
+
+func (c *compiler) visitSetIndexExpr(expr *SetIndex) interface{} {
+	c.compileExpr(expr.object)
+	c.compileExpr(expr.index)
+	c.compileExpr(expr.value)
+	c.token = expr.bracket
+	c.emitOp(OP_SET_INDEX)
+	return nil
+}
+
+func (c *compiler) visitSuperExpr(expr *Super) interface{} {
+	this := *expr.keyword
+	this.kind, this.lexeme = THIS, "this"
+	c.namedVariable(&this)
+	c.namedVariable(expr.keyword)
+	c.token = expr.method
+	c.emitOpShort(OP_GET_SUPER, c.makeConstant(expr.method.lexeme))
+	return nil
+}
+
+func (c *compiler) visitThisExpr(expr *This) interface{} {
+	c.namedVariable(expr.keyword)
+	return nil
+}
+
+func (c *compiler) visitUnaryExpr(expr *Unary) interface{} {
+	c.compileExpr(expr.right)
+	c.token = expr.operator
+	switch expr.operator.kind {
+	case BANG:
+		c.emitOp(OP_NOT)
+	case MINUS:
+		c.emitOp(OP_NEGATE)
+	}
+	return nil
+}
+
+func (c *compiler) visitVariableExpr(expr *Variable) interface{} {
+	c.namedVariable(expr.name)
+	return nil
+}
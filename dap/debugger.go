@@ -0,0 +1,90 @@
+package dap
+
+import (
+	"runtime"
+
+	"github.com/dessaya/lox"
+)
+
+// Statement implements lox.Debugger. It pauses the script at breakpoints, at
+// the end of a step, and when the client asks for it.
+func (s *server) Statement(state *lox.DebugState) {
+	s.mu.Lock()
+	if s.terminated {
+		s.mu.Unlock()
+		runtime.Goexit()
+	}
+
+	here := locationOf(state)
+	reason := ""
+	switch {
+	case s.pauseRequested && s.last == (location{}):
+		reason = "entry"
+	case s.pauseRequested:
+		reason = "pause"
+	case s.breakpoints[here.filename][here.line] && here != s.last:
+		reason = "breakpoint"
+	case s.stepDone(here):
+		reason = "step"
+	}
+	s.last = here
+	if reason == "" {
+		s.mu.Unlock()
+		return
+	}
+	s.wait(state, &stoppedBody{Reason: reason})
+}
+
+// Exception implements lox.Debugger. It pauses the script when a RuntimeError
+// is not going to be caught, unless the client disabled it.
+func (s *server) Exception(state *lox.DebugState, err lox.RuntimeError) {
+	s.mu.Lock()
+	if s.terminated {
+		s.mu.Unlock()
+		runtime.Goexit()
+	}
+	if !s.stopOnUncaught {
+		s.mu.Unlock()
+		return
+	}
+	s.wait(state, &stoppedBody{Reason: "exception", Description: "Uncaught error", Text: err.Error()})
+}
+
+// stepDone reports whether the step the script was resumed with ends at the
+// given location.
+func (s *server) stepDone(here location) bool {
+	sameLine := here.filename == s.from.filename && here.line == s.from.line
+	switch s.mode {
+	case stepInMode:
+		return here.depth != s.from.depth || !sameLine
+	case stepOverMode:
+		return here.depth < s.from.depth || (here.depth == s.from.depth && !sameLine)
+	case stepOutMode:
+		return here.depth < s.from.depth
+	}
+	return false
+}
+
+// wait tells the client that the script is paused, and waits until it is
+// resumed. It must be called with mu held, and releases it.
+func (s *server) wait(state *lox.DebugState, body *stoppedBody) {
+	s.stopped, s.references = state, nil
+	s.mode, s.pauseRequested = continueMode, false
+	s.mu.Unlock()
+
+	body.ThreadID, body.AllThreadsStopped = threadID, true
+	s.event("stopped", body)
+	<-s.resume
+
+	s.mu.Lock()
+	terminated := s.terminated
+	s.mu.Unlock()
+	if terminated {
+		runtime.Goexit()
+	}
+}
+
+func locationOf(state *lox.DebugState) location {
+	position := state.Position()
+	return location{filename: position.Filename, line: position.Line, depth: state.Depth()}
+}
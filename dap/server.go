@@ -0,0 +1,475 @@
+// Package dap implements a debugger for Lox scripts, speaking the Debug
+// Adapter Protocol over a pair of streams such as stdin and stdout.
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+
+	"github.com/dessaya/lox"
+	"github.com/dessaya/lox/internal/framing"
+)
+
+// Serve reads requests from in and writes the responses and events to out,
+// until the client sends the disconnect request. The script is run by the
+// launch request, and stopped when the client disconnects.
+func Serve(in io.Reader, out io.Writer) error {
+	s := &server{
+		out:            out,
+		breakpoints:    make(map[string]map[int]bool),
+		stopOnUncaught: true,
+		resume:         make(chan struct{}),
+	}
+	r := bufio.NewReader(in)
+	for {
+		b, err := framing.ReadMessage(r)
+		if err != nil {
+			s.terminate()
+			if err == io.EOF {
+				return errors.New("connection closed without disconnect request")
+			}
+			return err
+		}
+		var req request
+		if err := json.Unmarshal(b, &req); err != nil || req.Type != "request" {
+			continue
+		}
+		handler, ok := handlers[req.Command]
+		if !ok {
+			err = s.fail(&req, "Unsupported command: "+req.Command)
+		} else {
+			err = handler(s, &req)
+		}
+		if err != nil {
+			s.terminate()
+			return err
+		}
+		if req.Command == "disconnect" {
+			return nil
+		}
+	}
+}
+
+type server struct {
+	// writeMu guards the output, which is written by the goroutine reading
+	// the requests and the one running the script.
+	writeMu sync.Mutex
+	out     io.Writer
+	seq     int
+
+	// mu guards the rest of the fields.
+	mu             sync.Mutex
+	breakpoints    map[string]map[int]bool
+	stopOnUncaught bool
+	launch         *launchArguments
+	configured     bool
+	started        bool
+	terminated     bool
+	pauseRequested bool
+	// last is the location of the last statement executed.
+	last location
+
+	// stopped is the state of the script while it is paused, or nil if it
+	// is running. The script waits for a value on resume to continue.
+	stopped *lox.DebugState
+	resume  chan struct{}
+	// mode is how to continue when the script is resumed, and from where
+	// it was paused.
+	mode stepMode
+	from location
+	// references are the scopes and values whose variables the client can
+	// ask for while paused. The reference of each one is its index plus one.
+	references []interface{}
+}
+
+type stepMode int
+
+const (
+	continueMode stepMode = iota
+	stepInMode
+	stepOverMode
+	stepOutMode
+)
+
+// location is a line of code, and the depth of the calls when executing it.
+type location struct {
+	filename string
+	line     int
+	depth    int
+}
+
+var handlers = map[string]func(s *server, req *request) error{
+	"initialize":              (*server).initialize,
+	"launch":                  (*server).launchRequest,
+	"setBreakpoints":          (*server).setBreakpoints,
+	"setExceptionBreakpoints": (*server).setExceptionBreakpoints,
+	"configurationDone":       (*server).configurationDone,
+	"threads":                 (*server).threads,
+	"stackTrace":              (*server).stackTrace,
+	"scopes":                  (*server).scopes,
+	"variables":               (*server).variables,
+	"continue":                (*server).continueRequest,
+	"next":                    (*server).next,
+	"stepIn":                  (*server).stepIn,
+	"stepOut":                 (*server).stepOut,
+	"pause":                   (*server).pause,
+	"terminate":               (*server).terminateRequest,
+	"disconnect":              (*server).disconnect,
+}
+
+func (s *server) write(v interface{}) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.seq++
+	switch v := v.(type) {
+	case *response:
+		v.Seq = s.seq
+	case *event:
+		v.Seq = s.seq
+	}
+	return framing.WriteMessage(s.out, v)
+}
+
+func (s *server) respond(req *request, body interface{}) error {
+	return s.write(&response{Type: "response", RequestSeq: req.Seq, Success: true, Command: req.Command, Body: body})
+}
+
+func (s *server) fail(req *request, message string) error {
+	return s.write(&response{Type: "response", RequestSeq: req.Seq, Command: req.Command, Message: message})
+}
+
+func (s *server) event(name string, body interface{}) error {
+	return s.write(&event{Type: "event", Event: name, Body: body})
+}
+
+func (s *server) initialize(req *request) error {
+	err := s.respond(req, map[string]interface{}{
+		"supportsConfigurationDoneRequest": true,
+		"supportsTerminateRequest":         true,
+		"exceptionBreakpointFilters": []map[string]interface{}{
+			{"filter": "uncaught", "label": "Uncaught Errors", "default": true},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return s.event("initialized", nil)
+}
+
+func (s *server) launchRequest(req *request) error {
+	var args launchArguments
+	if err := decode(req, &args); err != nil {
+		return s.fail(req, err.Error())
+	}
+	if args.Program == "" {
+		return s.fail(req, "The program to debug is missing.")
+	}
+	if abs, err := filepath.Abs(args.Program); err == nil {
+		args.Program = abs
+	}
+	b, err := ioutil.ReadFile(args.Program)
+	if err != nil {
+		return s.fail(req, err.Error())
+	}
+	args.source = string(b)
+	s.mu.Lock()
+	s.launch = &args
+	s.mu.Unlock()
+	if err := s.respond(req, nil); err != nil {
+		return err
+	}
+	s.start()
+	return nil
+}
+
+func (s *server) setBreakpoints(req *request) error {
+	var args setBreakpointsArguments
+	if err := decode(req, &args); err != nil {
+		return s.fail(req, err.Error())
+	}
+	path := args.Source.Path
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	lines := make(map[int]bool)
+	breakpoints := []breakpoint{}
+	for _, b := range args.Breakpoints {
+		lines[b.Line] = true
+		breakpoints = append(breakpoints, breakpoint{Verified: true, Line: b.Line})
+	}
+	s.mu.Lock()
+	s.breakpoints[path] = lines
+	s.mu.Unlock()
+	return s.respond(req, map[string]interface{}{"breakpoints": breakpoints})
+}
+
+func (s *server) setExceptionBreakpoints(req *request) error {
+	var args setExceptionBreakpointsArguments
+	if err := decode(req, &args); err != nil {
+		return s.fail(req, err.Error())
+	}
+	s.mu.Lock()
+	s.stopOnUncaught = false
+	for _, filter := range args.Filters {
+		if filter == "uncaught" {
+			s.stopOnUncaught = true
+		}
+	}
+	s.mu.Unlock()
+	return s.respond(req, nil)
+}
+
+func (s *server) configurationDone(req *request) error {
+	s.mu.Lock()
+	s.configured = true
+	s.mu.Unlock()
+	if err := s.respond(req, nil); err != nil {
+		return err
+	}
+	s.start()
+	return nil
+}
+
+// start runs the script once it is launched and the client has finished
+// configuring the breakpoints.
+func (s *server) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.launch == nil || !s.configured || s.started {
+		return
+	}
+	s.started = true
+	if s.launch.StopOnEntry {
+		s.pauseRequested = true
+	}
+	go s.run(s.launch)
+}
+
+// run executes the script, and tells the client when it exits.
+func (s *server) run(args *launchArguments) {
+	options := []lox.Option{
+		lox.WithStdout(&output{s, "stdout"}),
+		lox.WithStderr(&output{s, "stderr"}),
+		lox.WithStdin(eofReader{}),
+	}
+	if !args.NoDebug {
+		options = append(options, lox.WithDebugger(s))
+	}
+	interpreter := lox.NewInterpreter(options...)
+	interpreter.SetScriptPath(args.Program)
+
+	exitCode := 0
+	if _, err := interpreter.Eval(args.source, args.Program); err != nil {
+		interpreter.Report(err)
+		switch err.(type) {
+		case lox.Diagnostics:
+			exitCode = 65
+		case lox.RuntimeError:
+			exitCode = 70
+		}
+	}
+	s.mu.Lock()
+	s.terminated = true
+	s.mu.Unlock()
+	s.event("exited", map[string]interface{}{"exitCode": exitCode})
+	s.event("terminated", nil)
+}
+
+// output sends what the script writes to the client.
+type output struct {
+	s        *server
+	category string
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	if err := o.s.event("output", &outputBody{Category: o.category, Output: string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// eofReader is the input of the script, since the standard input is used to
+// talk to the client.
+type eofReader struct{}
+
+func (eofReader) Read(p []byte) (int, error) { return 0, io.EOF }
+
+func (s *server) threads(req *request) error {
+	return s.respond(req, map[string]interface{}{
+		"threads": []map[string]interface{}{{"id": threadID, "name": "main"}},
+	})
+}
+
+func (s *server) stackTrace(req *request) error {
+	var args stackTraceArguments
+	if err := decode(req, &args); err != nil {
+		return s.fail(req, err.Error())
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped == nil {
+		return s.fail(req, "The script is not paused.")
+	}
+
+	trace := s.stopped.StackTrace()
+	frames := []stackFrame{}
+	for k, f := range trace {
+		if k < args.StartFrame || (args.Levels > 0 && len(frames) == args.Levels) {
+			continue
+		}
+		frame := stackFrame{ID: k + 1, Name: f.Function, Line: f.Position.Line, Column: f.Position.Column}
+		if f.Position.Filename != "" {
+			frame.Source = &source{Name: filepath.Base(f.Position.Filename), Path: f.Position.Filename}
+		}
+		frames = append(frames, frame)
+	}
+	return s.respond(req, map[string]interface{}{"stackFrames": frames, "totalFrames": len(trace)})
+}
+
+func (s *server) scopes(req *request) error {
+	var args scopesArguments
+	if err := decode(req, &args); err != nil {
+		return s.fail(req, err.Error())
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped == nil {
+		return s.fail(req, "The script is not paused.")
+	}
+	if args.FrameID < 1 || args.FrameID > len(s.stopped.StackTrace()) {
+		return s.fail(req, "Invalid frame.")
+	}
+
+	// The local scopes are shown together, hiding the shadowed variables.
+	var locals, globals []lox.DebugVariable
+	seen := make(map[string]bool)
+	for _, scope := range s.stopped.Scopes(args.FrameID - 1) {
+		if scope.Global {
+			globals = scope.Variables
+			continue
+		}
+		for _, v := range scope.Variables {
+			if !seen[v.Name] {
+				seen[v.Name] = true
+				locals = append(locals, v)
+			}
+		}
+	}
+	scopes := []scope{}
+	if len(locals) > 0 {
+		scopes = append(scopes, scope{Name: "Locals", VariablesReference: s.reference(locals)})
+	}
+	scopes = append(scopes, scope{Name: "Globals", VariablesReference: s.reference(globals)})
+	return s.respond(req, map[string]interface{}{"scopes": scopes})
+}
+
+// reference returns a new reference to the variables or value. It must be
+// called with mu held.
+func (s *server) reference(v interface{}) int {
+	s.references = append(s.references, v)
+	return len(s.references)
+}
+
+func (s *server) variables(req *request) error {
+	var args variablesArguments
+	if err := decode(req, &args); err != nil {
+		return s.fail(req, err.Error())
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if args.VariablesReference < 1 || args.VariablesReference > len(s.references) {
+		return s.fail(req, "Invalid variables reference.")
+	}
+
+	children, ok := s.references[args.VariablesReference-1].([]lox.DebugVariable)
+	if !ok {
+		_, children = lox.Inspect(s.references[args.VariablesReference-1])
+	}
+	variables := []variable{}
+	for _, child := range children {
+		value, grandchildren := lox.Inspect(child.Value)
+		v := variable{Name: child.Name, Value: value}
+		if len(grandchildren) > 0 {
+			v.VariablesReference = s.reference(child.Value)
+		}
+		variables = append(variables, v)
+	}
+	return s.respond(req, map[string]interface{}{"variables": variables})
+}
+
+func (s *server) continueRequest(req *request) error {
+	return s.step(req, continueMode, map[string]interface{}{"allThreadsContinued": true})
+}
+
+func (s *server) next(req *request) error {
+	return s.step(req, stepOverMode, nil)
+}
+
+func (s *server) stepIn(req *request) error {
+	return s.step(req, stepInMode, nil)
+}
+
+func (s *server) stepOut(req *request) error {
+	return s.step(req, stepOutMode, nil)
+}
+
+// step resumes the paused script, which pauses again according to the mode.
+func (s *server) step(req *request, mode stepMode, body interface{}) error {
+	s.mu.Lock()
+	stopped := s.stopped
+	if stopped == nil {
+		s.mu.Unlock()
+		return s.fail(req, "The script is not paused.")
+	}
+	s.mode, s.from = mode, locationOf(stopped)
+	s.stopped, s.references = nil, nil
+	s.mu.Unlock()
+
+	if err := s.respond(req, body); err != nil {
+		return err
+	}
+	s.resume <- struct{}{}
+	return nil
+}
+
+func (s *server) pause(req *request) error {
+	s.mu.Lock()
+	s.pauseRequested = true
+	s.mu.Unlock()
+	return s.respond(req, nil)
+}
+
+func (s *server) terminateRequest(req *request) error {
+	if err := s.respond(req, nil); err != nil {
+		return err
+	}
+	if s.terminate() {
+		return s.event("terminated", nil)
+	}
+	return nil
+}
+
+func (s *server) disconnect(req *request) error {
+	s.terminate()
+	return s.respond(req, nil)
+}
+
+// terminate stops the script the next time it executes a statement, and
+// reports whether it was running.
+func (s *server) terminate() bool {
+	s.mu.Lock()
+	running := s.started && !s.terminated
+	s.terminated = true
+	stopped := s.stopped
+	s.stopped, s.references = nil, nil
+	s.mu.Unlock()
+	if stopped != nil {
+		s.resume <- struct{}{}
+	}
+	return running
+}
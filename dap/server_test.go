@@ -0,0 +1,219 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/dessaya/lox/internal/framing"
+	"github.com/stretchr/testify/require"
+)
+
+// client talks to a server running in the background.
+type client struct {
+	t        *testing.T
+	w        io.Writer
+	messages chan map[string]interface{}
+	seq      int
+	done     chan error
+	output   string
+}
+
+func newClient(t *testing.T) *client {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &client{t: t, w: inW, messages: make(chan map[string]interface{}, 100), done: make(chan error, 1)}
+	go func() {
+		c.done <- Serve(inR, outW)
+		outW.Close()
+	}()
+	go func() {
+		defer close(c.messages)
+		r := bufio.NewReader(outR)
+		for {
+			b, err := framing.ReadMessage(r)
+			if err != nil {
+				return
+			}
+			var msg map[string]interface{}
+			if json.Unmarshal(b, &msg) == nil {
+				c.messages <- msg
+			}
+		}
+	}()
+	return c
+}
+
+// request sends a request and returns its response, which must be
+// successful.
+func (c *client) request(command string, arguments interface{}) map[string]interface{} {
+	c.seq++
+	msg := map[string]interface{}{"seq": c.seq, "type": "request", "command": command}
+	if arguments != nil {
+		msg["arguments"] = arguments
+	}
+	require.NoError(c.t, framing.WriteMessage(c.w, msg))
+	response := c.expect("response", command)
+	require.True(c.t, response["success"].(bool), response["message"])
+	body, _ := response["body"].(map[string]interface{})
+	return body
+}
+
+// expect reads messages until one of the given type and command or event
+// name, collecting the output of the script.
+func (c *client) expect(kind string, name string) map[string]interface{} {
+	for msg := range c.messages {
+		if msg["type"] == "event" && msg["event"] == "output" {
+			c.output += msg["body"].(map[string]interface{})["output"].(string)
+		}
+		if msg["type"] == kind && (msg["command"] == name || msg["event"] == name) {
+			return msg
+		}
+	}
+	c.t.Fatalf("the server closed the connection before sending %s %s", kind, name)
+	return nil
+}
+
+func (c *client) stopped(reason string) map[string]interface{} {
+	body := c.expect("event", "stopped")["body"].(map[string]interface{})
+	require.Equal(c.t, reason, body["reason"])
+	return body
+}
+
+// variables returns the values of the variables of the given scope of the
+// innermost frame.
+func (c *client) variables(scope string) map[string]string {
+	for _, s := range c.request("scopes", map[string]interface{}{"frameId": 1})["scopes"].([]interface{}) {
+		s := s.(map[string]interface{})
+		if s["name"] != scope {
+			continue
+		}
+		body := c.request("variables", map[string]interface{}{"variablesReference": s["variablesReference"]})
+		variables := make(map[string]string)
+		for _, v := range body["variables"].([]interface{}) {
+			v := v.(map[string]interface{})
+			variables[v["name"].(string)] = v["value"].(string)
+		}
+		return variables
+	}
+	return nil
+}
+
+func (c *client) lines() []float64 {
+	var lines []float64
+	for _, f := range c.request("stackTrace", map[string]interface{}{"threadId": 1})["stackFrames"].([]interface{}) {
+		lines = append(lines, f.(map[string]interface{})["line"].(float64))
+	}
+	return lines
+}
+
+func launch(t *testing.T, source string, breakpoints ...int) *client {
+	path := filepath.Join(t.TempDir(), "test.lox")
+	require.NoError(t, ioutil.WriteFile(path, []byte(source), 0644))
+
+	c := newClient(t)
+	c.request("initialize", map[string]interface{}{"adapterID": "lox"})
+	c.expect("event", "initialized")
+	c.request("launch", map[string]interface{}{"program": path})
+	var lines []map[string]interface{}
+	for _, line := range breakpoints {
+		lines = append(lines, map[string]interface{}{"line": line})
+	}
+	c.request("setBreakpoints", map[string]interface{}{"source": map[string]interface{}{"path": path}, "breakpoints": lines})
+	c.request("configurationDone", nil)
+	return c
+}
+
+func (c *client) exit(code int) {
+	exited := c.expect("event", "exited")
+	require.Equal(c.t, float64(code), exited["body"].(map[string]interface{})["exitCode"])
+	c.expect("event", "terminated")
+	c.request("disconnect", nil)
+	require.NoError(c.t, <-c.done)
+}
+
+func TestBreakpointsAndStepping(t *testing.T) {
+	c := launch(t, `fun add(a, b) {
+  var sum = a + b;
+  return sum;
+}
+var x = add(1, 2);
+print x;
+var list = [x, "four"];
+`, 2)
+
+	c.stopped("breakpoint")
+	require.Equal(t, []float64{2, 5}, c.lines())
+	require.Equal(t, map[string]string{"a": "1", "b": "2"}, c.variables("Locals"))
+
+	c.request("next", nil)
+	c.stopped("step")
+	require.Equal(t, []float64{3, 5}, c.lines())
+	require.Equal(t, map[string]string{"a": "1", "b": "2", "sum": "3"}, c.variables("Locals"))
+
+	c.request("stepOut", nil)
+	c.stopped("step")
+	require.Equal(t, []float64{6}, c.lines())
+	require.Equal(t, "3", c.variables("Globals")["x"])
+
+	c.request("stepIn", nil)
+	c.stopped("step")
+	require.Equal(t, []float64{7}, c.lines())
+	require.Equal(t, "3\n", c.output)
+
+	c.request("continue", nil)
+	c.exit(0)
+}
+
+func TestPauseOnUncaughtError(t *testing.T) {
+	c := launch(t, `fun f(x) {
+  try {
+    throw "caught";
+  } catch (e) {}
+  return x.field;
+}
+f(nil);
+`)
+
+	body := c.stopped("exception")
+	require.Equal(t, "Only instances have properties.", body["text"])
+	require.Equal(t, []float64{5, 7}, c.lines())
+	require.Equal(t, map[string]string{"x": "nil"}, c.variables("Locals"))
+
+	c.request("continue", nil)
+	c.exit(70)
+	require.Contains(t, c.output, "Only instances have properties.")
+}
+
+func TestStopOnEntryAndTerminate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "loop.lox")
+	require.NoError(t, ioutil.WriteFile(path, []byte("var m = {\"k\": [1]};\nwhile (true) m = m;\n"), 0644))
+
+	c := newClient(t)
+	c.request("initialize", nil)
+	c.request("launch", map[string]interface{}{"program": path, "stopOnEntry": true})
+	c.request("configurationDone", nil)
+	c.stopped("entry")
+	require.Equal(t, []float64{1}, c.lines())
+
+	c.request("next", nil)
+	c.stopped("step")
+	scopes := c.request("scopes", map[string]interface{}{"frameId": 1})["scopes"].([]interface{})
+	globals := scopes[0].(map[string]interface{})["variablesReference"]
+	m := c.request("variables", map[string]interface{}{"variablesReference": globals})["variables"].([]interface{})[0].(map[string]interface{})
+	require.Equal(t, `{"k": [1]}`, m["value"])
+	k := c.request("variables", map[string]interface{}{"variablesReference": m["variablesReference"]})["variables"].([]interface{})[0].(map[string]interface{})
+	require.Equal(t, map[string]interface{}{"name": `"k"`, "value": "[1]", "variablesReference": float64(3)}, k)
+
+	c.request("continue", nil)
+	c.request("pause", nil)
+	c.stopped("pause")
+
+	c.request("terminate", nil)
+	c.expect("event", "terminated")
+	c.request("disconnect", nil)
+	require.NoError(t, <-c.done)
+}
@@ -0,0 +1,257 @@
+package lox
+
+import (
+	"sort"
+	"strconv"
+)
+
+// Debugger is notified by the Interpreter as it executes the code, so that it
+// can pause the execution by not returning until the user resumes it.
+//
+// Debugging is only supported by the TreeWalker backend.
+type Debugger interface {
+	// Statement is called before executing each statement, except blocks.
+	Statement(state *DebugState)
+	// Exception is called when a RuntimeError is raised that no try
+	// statement is going to catch, before the stack is unwound.
+	Exception(state *DebugState, err RuntimeError)
+}
+
+// WithDebugger sets the Debugger that is notified of the execution of the
+// code.
+func WithDebugger(debugger Debugger) Option {
+	return func(i *Interpreter) { i.debugger = debugger }
+}
+
+// DebugState is the state of the execution when the Debugger is called. It
+// is only valid until the Debugger returns.
+type DebugState struct {
+	interpreter *Interpreter
+	token       *Token
+}
+
+// Position returns the location of the code that is about to be executed,
+// or that raised the error.
+func (s *DebugState) Position() Position {
+	return s.token.Position()
+}
+
+// Depth returns the number of active calls, which is 0 in top-level code.
+func (s *DebugState) Depth() int {
+	return len(s.interpreter.frames)
+}
+
+// StackTrace lists the active calls, starting from the innermost one.
+func (s *DebugState) StackTrace() []StackFrame {
+	return s.interpreter.stackTrace(s.token)
+}
+
+// Scope is an environment of variables.
+type Scope struct {
+	// Global is set for the top-level environment of a module or script.
+	Global    bool
+	Variables []DebugVariable
+}
+
+// DebugVariable is a named value.
+type DebugVariable struct {
+	Name  string
+	Value interface{}
+}
+
+// Scopes returns the environments visible from the given frame of the stack
+// trace, starting from the innermost one and ending with the globals.
+func (s *DebugState) Scopes(frame int) []Scope {
+	environment := s.interpreter.environment
+	if frame > 0 {
+		environment = s.interpreter.frames[len(s.interpreter.frames)-frame].environment
+	}
+
+	var scopes []Scope
+	for ; environment != nil; environment = environment.enclosing {
+		if environment.values == nil {
+			scope := Scope{}
+			for _, b := range environment.slots {
+				scope.Variables = append(scope.Variables, DebugVariable{b.name, b.value})
+			}
+			scopes = append(scopes, scope)
+			continue
+		}
+		// The builtins that enclose the globals are not included.
+		return append(scopes, Scope{Global: true, Variables: globalVariables(environment)})
+	}
+	return scopes
+}
+
+// Globals returns the global variables of the script, sorted by name.
+func (i *Interpreter) Globals() []DebugVariable {
+	return globalVariables(i.globals)
+}
+
+func globalVariables(environment *Environment) []DebugVariable {
+	var variables []DebugVariable
+	for name, value := range environment.values {
+		variables = append(variables, DebugVariable{name, value})
+	}
+	sort.Slice(variables, func(i, j int) bool { return variables[i].Name < variables[j].Name })
+	return variables
+}
+
+// Inspect returns the representation of a value, as it would be printed
+// inside a list, and the fields of instances, elements of lists and entries
+// of maps.
+func Inspect(value interface{}) (string, []DebugVariable) {
+	var children []DebugVariable
+	switch value := value.(type) {
+	case *LoxInstance:
+		children = fieldVariables(value.fields)
+	case *vmInstance:
+		children = fieldVariables(value.fields)
+	case *LoxList:
+		for k, element := range value.elements {
+			children = append(children, DebugVariable{strconv.Itoa(k), element})
+		}
+	case *LoxMap:
+		for _, entry := range value.order {
+			children = append(children, DebugVariable{stringifyElement(entry.key), entry.value})
+		}
+	}
+	return stringifyElement(value), children
+}
+
+// fieldVariables returns the fields of an instance, sorted by name.
+func fieldVariables(fields map[string]interface{}) []DebugVariable {
+	var variables []DebugVariable
+	for name, field := range fields {
+		variables = append(variables, DebugVariable{name, field})
+	}
+	sort.Slice(variables, func(i, j int) bool { return variables[i].Name < variables[j].Name })
+	return variables
+}
+
+// debugExecute executes the statement, notifying the debugger.
+func (i *Interpreter) debugExecute(stmt Stmt) completion {
+	return i.debug(stmtToken(stmt), func() completion {
+		c, _ := stmt.accept(i).(completion)
+		return c
+	})
+}
+
+// debug notifies the debugger before calling f, which executes the code at
+// the given token (which may be nil), and if it raises an uncaught error.
+func (i *Interpreter) debug(token *Token, f func() completion) completion {
+	if token != nil {
+		i.debugger.Statement(&DebugState{i, token})
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(RuntimeError); ok && !e.fatal {
+				i.uncaught(e, token)
+			}
+			panic(r)
+		}
+	}()
+	c := f()
+	if c == completionThrow {
+		i.uncaught(i.thrown, token)
+	}
+	return c
+}
+
+// uncaught notifies the debugger of an error raised while executing the
+// statement at the given token, unless it is going to be caught or it was
+// already notified.
+func (i *Interpreter) uncaught(err RuntimeError, token *Token) {
+	if i.catches > 0 || i.uncaughtNotified {
+		return
+	}
+	i.uncaughtNotified = true
+	if err.Token != nil {
+		token = err.Token
+	}
+	if token != nil {
+		i.debugger.Exception(&DebugState{i, token}, err)
+	}
+}
+
+// stmtToken returns a token of the statement at the line where it starts, or
+// nil if there is none.
+func stmtToken(stmt Stmt) *Token {
+	switch stmt := stmt.(type) {
+	case *Assert:
+		return stmt.keyword
+	case *Break:
+		return stmt.keyword
+	case *Class:
+		return stmt.name
+	case *Continue:
+		return stmt.keyword
+	case *Expression:
+		return exprToken(stmt.expression)
+	case *Function:
+		return stmt.name
+	case *If:
+		return stmt.keyword
+	case *Import:
+		return stmt.keyword
+	case *Print:
+		return stmt.keyword
+	case *Return:
+		return stmt.keyword
+	case *Throw:
+		return stmt.keyword
+	case *Try:
+		return stmt.keyword
+	case *Var:
+		return stmt.name
+	case *While:
+		return stmt.keyword
+	}
+	return nil
+}
+
+// exprToken returns the leftmost token of the expression that is known, or
+// nil if there is none.
+func exprToken(expr Expr) *Token {
+	switch expr := expr.(type) {
+	case *Assign:
+		return expr.name
+	case *Binary:
+		return firstToken(exprToken(expr.left), expr.operator)
+	case *Call:
+		return firstToken(exprToken(expr.callee), expr.paren)
+	case *Get:
+		return firstToken(exprToken(expr.object), expr.name)
+	case *Grouping:
+		return exprToken(expr.expression)
+	case *Index:
+		return firstToken(exprToken(expr.object), expr.bracket)
+	case *List:
+		return expr.bracket
+	case *Logical:
+		return firstToken(exprToken(expr.left), expr.operator)
+	case *Map:
+		return expr.brace
+	case *Set:
+		return firstToken(exprToken(expr.object), expr.name)
+	case *SetIndex:
+		return firstToken(exprToken(expr.object), expr.bracket)
+	case *Super:
+		return expr.keyword
+	case *This:
+		return expr.keyword
+	case *Unary:
+		return expr.operator
+	case *Variable:
+		return expr.name
+	}
+	return nil
+}
+
+func firstToken(token *Token, fallback *Token) *Token {
+	if token != nil {
+		return token
+	}
+	return fallback
+}
@@ -0,0 +1,121 @@
+package lox
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recorder is a Debugger that records where it was called.
+type recorder struct {
+	lines      []int
+	depths     []int
+	exceptions []string
+	scopes     [][]Scope
+}
+
+func (r *recorder) Statement(state *DebugState) {
+	r.lines = append(r.lines, state.Position().Line)
+	r.depths = append(r.depths, state.Depth())
+}
+
+func (r *recorder) Exception(state *DebugState, err RuntimeError) {
+	r.exceptions = append(r.exceptions, err.Error())
+	r.scopes = append(r.scopes, state.Scopes(0), state.Scopes(1))
+}
+
+func TestDebuggerStatements(t *testing.T) {
+	r := &recorder{}
+	i := NewInterpreter(WithDebugger(r), WithStdout(ioutil.Discard))
+	_, err := i.Eval(`fun f(n) {
+  if (n > 0)
+    return n;
+  print 1;
+}
+for (var i = 0; i < 2; i = i + 1)
+  f(i);
+f(2);
+`, "")
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 6, 6, 7, 2, 4, 7, 2, 3, 8, 2, 3}, r.lines)
+	require.Equal(t, []int{0, 0, 0, 0, 1, 1, 0, 1, 1, 0, 1, 1}, r.depths)
+	require.Nil(t, r.exceptions)
+}
+
+func TestDebuggerUncaughtErrors(t *testing.T) {
+	r := &recorder{}
+	i := NewInterpreter(WithDebugger(r))
+	_, err := i.Eval(`fun f(x) {
+  try { nil(); } catch (e) {}
+  {
+    var y = "y";
+    throw x + y;
+  }
+}
+var a = f("x");
+`, "")
+	require.Error(t, err)
+	require.Equal(t, []string{"xy"}, r.exceptions)
+
+	local := []Scope{
+		{Variables: []DebugVariable{{"y", "y"}}},
+		{Variables: []DebugVariable{{"x", "x"}}},
+	}
+	global := Scope{Global: true, Variables: []DebugVariable{{"f", i.globals.values["f"]}}}
+	require.Equal(t, append(local, global), r.scopes[0])
+	require.Equal(t, []Scope{global}, r.scopes[1])
+}
+
+func TestDebuggerUncaughtErrorsInFinally(t *testing.T) {
+	r := &recorder{}
+	i := NewInterpreter(WithDebugger(r), WithStdout(ioutil.Discard))
+	_, err := i.Eval(`fun f() {
+  try {
+    var y = "y";
+    throw y;
+  } finally {
+    print "finally";
+  }
+}
+f();
+`, "")
+	require.EqualError(t, err, "y")
+	// The error is reported where it is thrown, since no catch clause
+	// handles it.
+	require.Equal(t, []string{"y"}, r.exceptions)
+	require.Equal(t, []DebugVariable{{"y", "y"}}, r.scopes[0][0].Variables)
+
+	r = &recorder{}
+	i = NewInterpreter(WithDebugger(r), WithStdout(ioutil.Discard))
+	_, err = i.Eval(`fun g() {
+  try { throw 1; } catch (e) { var z = e + 1; throw z; } finally {}
+}
+g();
+`, "")
+	require.EqualError(t, err, "2")
+	require.Equal(t, []string{"2"}, r.exceptions)
+	require.Equal(t, []DebugVariable{{"z", 2.0}}, r.scopes[0][0].Variables)
+}
+
+func TestInspect(t *testing.T) {
+	value, err := NewInterpreter().Eval(`class A {}
+var a = A();
+a.list = [1, "two"];
+a.map = {nil: true};
+a;
+`, "")
+	require.NoError(t, err)
+
+	s, fields := Inspect(value)
+	require.Equal(t, "A instance", s)
+	require.Len(t, fields, 2)
+	require.Equal(t, "list", fields[0].Name)
+
+	s, elements := Inspect(fields[0].Value)
+	require.Equal(t, `[1, "two"]`, s)
+	require.Equal(t, []DebugVariable{{"0", 1.0}, {"1", "two"}}, elements)
+
+	_, entries := Inspect(fields[1].Value)
+	require.Equal(t, []DebugVariable{{"nil", true}}, entries)
+}
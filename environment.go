@@ -1,10 +1,29 @@
 package lox
 
+// Environment holds the variables of a scope. Global environments (the
+// builtins and the top level of each module) look up their variables by name,
+// while local environments keep them in slots, in the order they were
+// declared, so that they can be found by the index assigned by the Resolver.
 type Environment struct {
 	values    map[string]interface{}
+	slots     []binding
 	enclosing *Environment
 }
 
+type binding struct {
+	name  string
+	value interface{}
+}
+
+// localSlot is the location of a local variable, as computed by the Resolver:
+// the number of environments to walk up from the current one, and the index
+// of the variable in that environment.
+type localSlot struct {
+	depth int
+	slot  int
+}
+
+// NewEnvironment returns a global environment.
 func NewEnvironment(enclosing *Environment) *Environment {
 	return &Environment{
 		values:    make(map[string]interface{}),
@@ -12,7 +31,20 @@ func NewEnvironment(enclosing *Environment) *Environment {
 	}
 }
 
+// newLocalEnvironment returns an environment for a local scope, with room for
+// the given number of variables.
+func newLocalEnvironment(enclosing *Environment, size int) *Environment {
+	return &Environment{
+		slots:     make([]binding, 0, size),
+		enclosing: enclosing,
+	}
+}
+
 func (e *Environment) define(name string, value interface{}) {
+	if e.values == nil {
+		e.slots = append(e.slots, binding{name, value})
+		return
+	}
 	e.values[name] = value
 }
 
@@ -26,8 +58,19 @@ func (e *Environment) get(name *Token) interface{} {
 	panic(NewRuntimeError(name, "Undefined variable '"+name.lexeme+"'."))
 }
 
-func (e *Environment) getAt(distance int, name string) interface{} {
-	return e.ancestor(distance).values[name]
+func (e *Environment) getAt(name *Token, local *localSlot) interface{} {
+	return e.slotAt(name, local).value
+}
+
+// slotAt returns the binding of a local variable. A closure can refer to a
+// variable before it is defined, while running its initializer, and then
+// its slot doesn't exist yet.
+func (e *Environment) slotAt(name *Token, local *localSlot) *binding {
+	environment := e.ancestor(local.depth)
+	if local.slot >= len(environment.slots) {
+		panic(NewRuntimeError(name, "Undefined variable '"+name.lexeme+"'."))
+	}
+	return &environment.slots[local.slot]
 }
 
 func (e *Environment) ancestor(distance int) *Environment {
@@ -50,6 +93,6 @@ func (e *Environment) assign(name *Token, value interface{}) {
 	panic(NewRuntimeError(name, "Undefined variable '"+name.lexeme+"'."))
 }
 
-func (e *Environment) assignAt(distance int, name *Token, value interface{}) {
-	e.ancestor(distance).values[name.lexeme] = value
+func (e *Environment) assignAt(name *Token, local *localSlot, value interface{}) {
+	e.slotAt(name, local).value = value
 }
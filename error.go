@@ -1,30 +1,187 @@
 package lox
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type Severity int
 
-var (
-	HadError        bool
-	HadRuntimeError bool
+const (
+	SeverityError = Severity(iota)
+	SeverityWarning
 )
 
-func ReportError(line int, message string) {
-	report(line, "", message)
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "Error"
+	case SeverityWarning:
+		return "Warning"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// Position is a location in the source code.
+type Position struct {
+	// Filename is empty if the source code was not read from a file.
+	Filename string
+	Line     int
+	// Column is 1-based and counted in runes.
+	Column int
+	// Offset and End are the byte offsets of the start and end of the
+	// offending text.
+	Offset int
+	End    int
 }
 
-func ReportTokenError(token *Token, message string) {
-	if token.kind == EOF {
-		report(token.line, " at end", message)
-	} else {
-		report(token.line, " at '"+token.lexeme+"'", message)
+func (p Position) String() string {
+	s := strconv.Itoa(p.Line) + ":" + strconv.Itoa(p.Column)
+	if p.Filename != "" {
+		s = p.Filename + ":" + s
+	}
+	return s
+}
+
+// Diagnostic is a problem found while scanning, parsing or resolving.
+type Diagnostic struct {
+	Severity Severity
+	Message  string
+	// Token is the offending token, or nil if the problem was found by the
+	// scanner.
+	Token *Token
+	Position
+
+	source *Source
+}
+
+func (d *Diagnostic) Error() string {
+	where := ""
+	if d.Token != nil {
+		if d.Token.kind == EOF {
+			where = " at end"
+		} else {
+			where = " at '" + d.Token.lexeme + "'"
+		}
 	}
+	return fmt.Sprintf("[line %d] %s%s: %s", d.Line, d.Severity, where, d.Message)
+}
+
+// Render formats the diagnostic along with the offending line of source code,
+// with the problematic text underlined.
+func (d *Diagnostic) Render() string {
+	return render(d.source, d.Position, strings.ToLower(d.Severity.String()), d.Message)
+}
+
+// Diagnostics is the list of problems reported by the scanner, parser or
+// resolver, in the order they were found.
+type Diagnostics []*Diagnostic
+
+func (ds *Diagnostics) add(d *Diagnostic) {
+	*ds = append(*ds, d)
 }
 
-func ReportRuntimeError(err RuntimeError) {
-	fmt.Printf("%s\n[line %d]\n", err.Error(), err.Token.line)
-	HadRuntimeError = true
+func (ds *Diagnostics) errorAt(token *Token, message string) {
+	ds.addAt(SeverityError, token, message)
 }
 
-func report(line int, where string, message string) {
-	fmt.Printf("[line %d] Error%s: %s\n", line, where, message)
-	HadError = true
+func (ds *Diagnostics) warningAt(token *Token, message string) {
+	ds.addAt(SeverityWarning, token, message)
+}
+
+func (ds *Diagnostics) addAt(severity Severity, token *Token, message string) {
+	ds.add(&Diagnostic{
+		Severity: severity,
+		Message:  message,
+		Token:    token,
+		Position: token.Position(),
+		source:   token.source,
+	})
+}
+
+// HasErrors reports whether any of the diagnostics is an error (as opposed
+// to a warning).
+func (ds Diagnostics) HasErrors() bool {
+	for _, d := range ds {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns the diagnostics as an error, or nil if there are no errors.
+func (ds Diagnostics) Err() error {
+	if !ds.HasErrors() {
+		return nil
+	}
+	return ds
+}
+
+func (ds Diagnostics) Error() string {
+	lines := make([]string, len(ds))
+	for i, d := range ds {
+		lines[i] = d.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Render formats all the diagnostics, as returned by Diagnostic.Render.
+func (ds Diagnostics) Render() string {
+	var b strings.Builder
+	for _, d := range ds {
+		b.WriteString(d.Render())
+	}
+	return b.String()
+}
+
+// render formats a message in the style of clang:
+//
+//	file.lox:3:7: error: Undefined variable 'foo'.
+//	    3 | print foo + 1;
+//	      |       ^~~
+func render(source *Source, pos Position, label string, message string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s: %s\n", pos, label, message)
+	if source == nil || pos.Offset > len(source.Text) {
+		return b.String()
+	}
+
+	text := source.Text
+	lineStart := strings.LastIndexByte(text[:pos.Offset], '\n') + 1
+	lineEnd := strings.IndexByte(text[pos.Offset:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(text)
+	} else {
+		lineEnd += pos.Offset
+	}
+	line := strings.TrimRight(text[lineStart:lineEnd], "\r")
+
+	number := strconv.Itoa(pos.Line)
+	gutter := strings.Repeat(" ", len(number))
+	fmt.Fprintf(&b, " %s | %s\n", number, line)
+
+	// Keep tabs in the indentation so that the caret is aligned with the
+	// offending text.
+	var indent strings.Builder
+	for _, r := range text[lineStart:pos.Offset] {
+		if r == '\t' {
+			indent.WriteRune('\t')
+		} else {
+			indent.WriteRune(' ')
+		}
+	}
+
+	end := pos.End
+	if end > lineEnd {
+		end = lineEnd
+	}
+	width := utf8.RuneCountInString(text[pos.Offset:end])
+	if width < 1 {
+		width = 1
+	}
+	fmt.Fprintf(&b, " %s | %s^%s\n", gutter, indent.String(), strings.Repeat("~", width-1))
+	return b.String()
 }
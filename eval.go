@@ -0,0 +1,87 @@
+package lox
+
+import "context"
+
+// Eval scans, parses, resolves and executes the source code. filename is
+// used for error reporting and to resolve relative imports, and may be empty.
+//
+// If the last statement is an expression statement, Eval returns its value.
+// Lox values are represented as nil, bool, float64, string or one of the Lox*
+// types, such as *LoxInstance or *LoxList.
+//
+// With the BytecodeVM backend, functions, classes and instances declared in
+// Lox are represented by unexported types instead of *LoxFunction, *LoxClass
+// and *LoxInstance. Like those, they implement fmt.Stringer and can be
+// examined with Inspect, but they can't be called from Go.
+//
+// The returned error is a Diagnostics if the code could not be compiled, or a
+// RuntimeError if the execution was aborted.
+func (i *Interpreter) Eval(source string, filename string) (interface{}, error) {
+	return i.EvalContext(context.Background(), source, filename)
+}
+
+// EvalContext is like Eval, but aborts the execution with a RuntimeError when
+// the context is done.
+func (i *Interpreter) EvalContext(ctx context.Context, source string, filename string) (interface{}, error) {
+	statements, diagnostics := i.compile(source, filename)
+	if diagnostics.HasErrors() {
+		return nil, diagnostics
+	}
+
+	if i.backend == BytecodeVM {
+		function, diagnostics := compileScript(statements, true)
+		if diagnostics.HasErrors() {
+			return nil, diagnostics
+		}
+		var value interface{}
+		err := i.run(ctx, func() { value = i.vm.interpret(function, i.globals) })
+		if err != nil {
+			return nil, err
+		}
+		return value, nil
+	}
+
+	var last *Expression
+	if n := len(statements); n > 0 {
+		if stmt, ok := statements[n-1].(*Expression); ok {
+			last = stmt
+			statements = statements[:n-1]
+		}
+	}
+
+	var value interface{}
+	err := i.run(ctx, func() {
+		i.executeTopLevel(statements)
+		if last == nil {
+			return
+		}
+		if i.debugger != nil {
+			i.debug(stmtToken(last), func() completion {
+				value = i.evaluate(last.expression)
+				return completionNormal
+			})
+			return
+		}
+		value = i.evaluate(last.expression)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// compile scans, parses and resolves the source code, and optimizes it if
+// enabled.
+func (i *Interpreter) compile(source string, filename string) ([]Stmt, Diagnostics) {
+	tokens, diagnostics := NewFileScanner(filename, source).ScanTokens()
+	statements, parseDiagnostics := NewParser(tokens).Parse()
+	diagnostics = append(diagnostics, parseDiagnostics...)
+	if diagnostics.HasErrors() {
+		return nil, diagnostics
+	}
+	diagnostics = append(diagnostics, NewResolver().Resolve(statements)...)
+	if i.optimize && !diagnostics.HasErrors() {
+		statements = NewOptimizer().Optimize(statements)
+	}
+	return statements, diagnostics
+}
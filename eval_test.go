@@ -0,0 +1,167 @@
+package lox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalReturnsLastExpression(t *testing.T) {
+	i := NewInterpreter()
+
+	v, err := i.Eval("var a = 1; a + 2;", "")
+	require.NoError(t, err)
+	require.Equal(t, 3.0, v)
+
+	v, err = i.Eval("var b = a;", "")
+	require.NoError(t, err)
+	require.Nil(t, v)
+
+	v, err = i.Eval(`"a" + "b";`, "")
+	require.NoError(t, err)
+	require.Equal(t, "ab", v)
+}
+
+func TestEvalResultTypes(t *testing.T) {
+	scripts := map[string]interface{}{
+		"nil;":                      nil,
+		"true;":                     true,
+		"1 + 2;":                    3.0,
+		`"a";`:                      "a",
+		"[1];":                      &LoxList{},
+		"var m = {1: 2}; m;":        &LoxMap{},
+		"clock;":                    Clock{},
+		"fun f() {} f;":             &LoxFunction{},
+		"fun () {};":                &LoxFunction{},
+		"class A {} A;":             &LoxClass{},
+		"class A {} A();":           &LoxInstance{},
+		"class A { m() {} } A().m;": &LoxFunction{},
+	}
+	for script, expected := range scripts {
+		walkerValue, err := NewInterpreter().Eval(script, "")
+		require.NoError(t, err)
+		require.IsType(t, expected, walkerValue, script)
+
+		vmValue, err := NewInterpreter(WithBackend(BytecodeVM)).Eval(script, "")
+		require.NoError(t, err)
+		if _, ok := walkerValue.(fmt.Stringer); ok {
+			require.Implements(t, (*fmt.Stringer)(nil), vmValue, script)
+		} else {
+			require.IsType(t, expected, vmValue, script)
+		}
+		s, children := Inspect(walkerValue)
+		vmString, vmChildren := Inspect(vmValue)
+		require.Equal(t, s, vmString, script)
+		require.Equal(t, children, vmChildren, script)
+	}
+
+	// Inspect lists the fields of instances on both backends.
+	for _, backend := range []Backend{TreeWalker, BytecodeVM} {
+		value, err := NewInterpreter(WithBackend(backend)).Eval("class A {} var a = A(); a.y = 2; a.x = 1; a;", "")
+		require.NoError(t, err)
+		s, fields := Inspect(value)
+		require.Equal(t, "A instance", s)
+		require.Equal(t, []DebugVariable{{"x", 1.0}, {"y", 2.0}}, fields)
+	}
+}
+
+func TestEvalCompileErrors(t *testing.T) {
+	_, err := NewInterpreter().Eval("var a = ;\nprint this;\nreturn 1;", "test.lox")
+	require.IsType(t, Diagnostics{}, err)
+
+	diagnostics := err.(Diagnostics)
+	require.Len(t, diagnostics, 1)
+	require.Equal(t, "Expect expression.", diagnostics[0].Message)
+	require.Equal(t, Position{Filename: "test.lox", Line: 1, Column: 9, Offset: 8, End: 9}, diagnostics[0].Position)
+
+	_, err = NewInterpreter().Eval("print this;\nreturn 1;", "")
+	require.EqualError(t, err, "[line 1] Error at 'this': Can't use 'this' outside of a class.\n"+
+		"[line 2] Error at 'return': Can't return from top-level code.")
+}
+
+func TestEvalRuntimeError(t *testing.T) {
+	_, err := NewInterpreter().Eval("fun f() {\n  return -nil;\n}\nf();", "")
+	require.IsType(t, RuntimeError{}, err)
+
+	e := err.(RuntimeError)
+	require.EqualError(t, e, "Operand must be a number.")
+	require.Equal(t, 2, e.Token.Line())
+	require.Equal(t, []string{"f", "script"}, []string{e.StackTrace[0].Function, e.StackTrace[1].Function})
+}
+
+func TestLocalUsedBeforeDefinition(t *testing.T) {
+	scripts := map[string]int{
+		"{ var f = (fun () { return f; })(); print f; }": 28,
+		"{\n  var f = (fun () { f = 1; })();\n}":         21,
+	}
+	for script, column := range scripts {
+		for _, backend := range []Backend{TreeWalker, BytecodeVM} {
+			_, err := NewInterpreter(WithBackend(backend)).Eval(script, "")
+			require.EqualError(t, err, "Undefined variable 'f'.", script)
+			require.Equal(t, column, err.(RuntimeError).Token.Column(), script)
+		}
+	}
+}
+
+func TestEvalAssert(t *testing.T) {
+	i := NewInterpreter()
+	_, err := i.Eval("var a = [1, 2];\nassert a[0] == 1;\nassert a[1] == 2, nil();", "")
+	require.NoError(t, err)
+
+	_, err = i.Eval("assert a.length()  >  2,\n  \"length is \" + \"2\";", "")
+	require.EqualError(t, err, "Assertion failed: a.length()  >  2: length is 2")
+	require.True(t, errors.Is(err, ErrAssertionFailed))
+	require.Equal(t, 1, err.(RuntimeError).Token.Line())
+
+	v, err := i.Eval("var m; try { assert false; } catch (e) { m = e.message; } m;", "")
+	require.NoError(t, err)
+	require.Equal(t, "Assertion failed: false", v)
+
+	_, err = i.Eval("assert true", "")
+	require.EqualError(t, err, "[line 1] Error at end: Expect ';' after assertion.")
+}
+
+func TestOutputStreams(t *testing.T) {
+	var stdout, stderr strings.Builder
+	i := NewInterpreter(WithStdout(&stdout), WithStderr(&stderr))
+
+	_, err := i.Eval("print 1;\nprint \"two\";\nprint -nil;", "script.lox")
+	require.Error(t, err)
+	i.Report(err)
+
+	require.Equal(t, "1\ntwo\n", stdout.String())
+	require.Equal(t, "script.lox:3:7: runtime error: Operand must be a number.\n"+
+		" 3 | print -nil;\n"+
+		"   |       ^\n", stderr.String())
+}
+
+func TestExecutionLimits(t *testing.T) {
+	_, err := NewInterpreter(WithStepLimit(100)).Eval("while (true) { try {} catch (e) {} }", "")
+	require.EqualError(t, err, "Step limit exceeded.")
+
+	_, err = NewInterpreter(WithMaxCallDepth(50)).Eval("fun f() { f(); } f();", "")
+	require.EqualError(t, err, "Stack overflow.")
+	require.Len(t, err.(RuntimeError).StackTrace, 51)
+
+	// The limit is the number of nested calls, on both backends.
+	recurse := "fun f(n) { if (n > 1) f(n - 1); } class A { init(n) { f(n); } }\n"
+	for _, backend := range []Backend{TreeWalker, BytecodeVM} {
+		i := NewInterpreter(WithBackend(backend), WithMaxCallDepth(10))
+		_, err = i.Eval(recurse+"f(10); A(9);", "")
+		require.NoError(t, err, backend)
+		_, err = i.Eval("f(11);", "")
+		require.EqualError(t, err, "Stack overflow.", backend)
+		_, err = i.Eval("A(10);", "")
+		require.EqualError(t, err, "Stack overflow.", backend)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = NewInterpreter().EvalContext(ctx, "while (true) {}", "")
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+}
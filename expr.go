@@ -9,6 +9,7 @@ type Expr interface {
 type Assign struct {
 	name  *Token
 	value Expr
+	local *localSlot
 }
 
 func NewAssign(name *Token, value Expr) *Assign {
@@ -58,6 +59,22 @@ func (c *Call) accept(ev ExprVisitor) interface{} {
 	return ev.visitCallExpr(c)
 }
 
+type Get struct {
+	object Expr
+	name   *Token
+}
+
+func NewGet(object Expr, name *Token) *Get {
+	return &Get{
+		object: object,
+		name:   name,
+	}
+}
+
+func (g *Get) accept(ev ExprVisitor) interface{} {
+	return ev.visitGetExpr(g)
+}
+
 type Grouping struct {
 	expression Expr
 }
@@ -72,6 +89,54 @@ func (g *Grouping) accept(ev ExprVisitor) interface{} {
 	return ev.visitGroupingExpr(g)
 }
 
+type Index struct {
+	object  Expr
+	bracket *Token
+	index   Expr
+}
+
+func NewIndex(object Expr, bracket *Token, index Expr) *Index {
+	return &Index{
+		object:  object,
+		bracket: bracket,
+		index:   index,
+	}
+}
+
+func (i *Index) accept(ev ExprVisitor) interface{} {
+	return ev.visitIndexExpr(i)
+}
+
+type Lambda struct {
+	declaration *Function
+}
+
+func NewLambda(declaration *Function) *Lambda {
+	return &Lambda{
+		declaration: declaration,
+	}
+}
+
+func (l *Lambda) accept(ev ExprVisitor) interface{} {
+	return ev.visitLambdaExpr(l)
+}
+
+type List struct {
+	bracket  *Token
+	elements []Expr
+}
+
+func NewList(bracket *Token, elements []Expr) *List {
+	return &List{
+		bracket:  bracket,
+		elements: elements,
+	}
+}
+
+func (l *List) accept(ev ExprVisitor) interface{} {
+	return ev.visitListExpr(l)
+}
+
 type Literal struct {
 	value interface{}
 }
@@ -104,6 +169,94 @@ func (l *Logical) accept(ev ExprVisitor) interface{} {
 	return ev.visitLogicalExpr(l)
 }
 
+type Map struct {
+	brace  *Token
+	keys   []Expr
+	values []Expr
+}
+
+func NewMap(brace *Token, keys []Expr, values []Expr) *Map {
+	return &Map{
+		brace:  brace,
+		keys:   keys,
+		values: values,
+	}
+}
+
+func (m *Map) accept(ev ExprVisitor) interface{} {
+	return ev.visitMapExpr(m)
+}
+
+type Set struct {
+	object Expr
+	name   *Token
+	value  Expr
+}
+
+func NewSet(object Expr, name *Token, value Expr) *Set {
+	return &Set{
+		object: object,
+		name:   name,
+		value:  value,
+	}
+}
+
+func (s *Set) accept(ev ExprVisitor) interface{} {
+	return ev.visitSetExpr(s)
+}
+
+type SetIndex struct {
+	object  Expr
+	bracket *Token
+	index   Expr
+	value   Expr
+}
+
+func NewSetIndex(object Expr, bracket *Token, index Expr, value Expr) *SetIndex {
+	return &SetIndex{
+		object:  object,
+		bracket: bracket,
+		index:   index,
+		value:   value,
+	}
+}
+
+func (s *SetIndex) accept(ev ExprVisitor) interface{} {
+	return ev.visitSetIndexExpr(s)
+}
+
+type Super struct {
+	keyword *Token
+	method  *Token
+	local   *localSlot
+}
+
+func NewSuper(keyword *Token, method *Token) *Super {
+	return &Super{
+		keyword: keyword,
+		method:  method,
+	}
+}
+
+func (s *Super) accept(ev ExprVisitor) interface{} {
+	return ev.visitSuperExpr(s)
+}
+
+type This struct {
+	keyword *Token
+	local   *localSlot
+}
+
+func NewThis(keyword *Token) *This {
+	return &This{
+		keyword: keyword,
+	}
+}
+
+func (t *This) accept(ev ExprVisitor) interface{} {
+	return ev.visitThisExpr(t)
+}
+
 type Unary struct {
 	operator *Token
 	right    Expr
@@ -121,7 +274,8 @@ func (u *Unary) accept(ev ExprVisitor) interface{} {
 }
 
 type Variable struct {
-	name *Token
+	name  *Token
+	local *localSlot
 }
 
 func NewVariable(name *Token) *Variable {
@@ -138,9 +292,18 @@ type ExprVisitor interface {
 	visitAssignExpr(a *Assign) interface{}
 	visitBinaryExpr(b *Binary) interface{}
 	visitCallExpr(c *Call) interface{}
+	visitGetExpr(g *Get) interface{}
 	visitGroupingExpr(g *Grouping) interface{}
+	visitIndexExpr(i *Index) interface{}
+	visitLambdaExpr(l *Lambda) interface{}
+	visitListExpr(l *List) interface{}
 	visitLiteralExpr(l *Literal) interface{}
 	visitLogicalExpr(l *Logical) interface{}
+	visitMapExpr(m *Map) interface{}
+	visitSetExpr(s *Set) interface{}
+	visitSetIndexExpr(s *SetIndex) interface{}
+	visitSuperExpr(s *Super) interface{}
+	visitThisExpr(t *This) interface{}
 	visitUnaryExpr(u *Unary) interface{}
 	visitVariableExpr(v *Variable) interface{}
 }
@@ -0,0 +1,235 @@
+package lox
+
+import "strings"
+
+// formatIndent is the indentation of each nesting level of blocks.
+const formatIndent = "  "
+
+// Format returns the source code in canonical form: one statement per line,
+// blocks indented by two spaces with the opening brace at the end of the line,
+// and single spaces around binary operators. Comments and single blank lines
+// between statements are preserved.
+//
+// The code must be syntactically valid, otherwise the diagnostics are
+// returned.
+func Format(filename string, source string) (string, Diagnostics) {
+	scanner := NewFileScanner(filename, source)
+	tokens, diagnostics := scanner.ScanTokens()
+	if diagnostics.HasErrors() {
+		return "", diagnostics
+	}
+	if _, diagnostics := NewParser(tokens).Parse(); diagnostics.HasErrors() {
+		return "", diagnostics
+	}
+
+	f := &formatter{}
+	f.format(tokens, scanner.Comments())
+	return f.b.String(), nil
+}
+
+// nesting is a kind of bracket that is open at some point of the code.
+type nesting int
+
+const (
+	parenNesting nesting = iota
+	// forNesting is the parenthesized header of a for loop.
+	forNesting
+	bracketNesting
+	blockNesting
+	mapNesting
+)
+
+// formatter prints the tokens back, deciding the whitespace between them
+// from the kinds of the neighboring tokens and the brackets they are nested
+// in.
+type formatter struct {
+	b       strings.Builder
+	indent  int
+	nesting []nesting
+
+	// prev is the last token written, and unary whether it was a unary
+	// operator.
+	prev  *Token
+	unary bool
+	// lastLine is the line of the source code where the last token or
+	// comment written ended.
+	lastLine int
+	// newline is set when the next token must go on a new line, and opened
+	// when that line is the first one of a block.
+	newline bool
+	opened  bool
+}
+
+func (f *formatter) format(tokens []*Token, comments []*Token) {
+	for k, token := range tokens {
+		for len(comments) > 0 && comments[0].offset < token.offset {
+			f.comment(comments[0])
+			comments = comments[1:]
+		}
+		if token.kind == EOF {
+			break
+		}
+		f.token(token, tokens[k+1], len(comments) > 0 && comments[0].offset < tokens[k+1].offset)
+	}
+	if f.b.Len() > 0 {
+		f.b.WriteString("\n")
+	}
+}
+
+func (f *formatter) top() nesting {
+	if len(f.nesting) == 0 {
+		return blockNesting
+	}
+	return f.nesting[len(f.nesting)-1]
+}
+
+func (f *formatter) push(n nesting) {
+	f.nesting = append(f.nesting, n)
+}
+
+func (f *formatter) pop() {
+	if len(f.nesting) > 0 {
+		f.nesting = f.nesting[:len(f.nesting)-1]
+	}
+}
+
+// startLine begins a new line for something that starts at the given line
+// of the source code, keeping a blank line if there was one.
+func (f *formatter) startLine(line int, closing bool) {
+	if f.b.Len() > 0 {
+		f.b.WriteString("\n")
+		if line > f.lastLine+1 && !f.opened && !closing {
+			f.b.WriteString("\n")
+		}
+	}
+	f.b.WriteString(strings.Repeat(formatIndent, f.indent))
+	f.newline, f.opened = false, false
+}
+
+func (f *formatter) comment(comment *Token) {
+	text := strings.TrimRight(comment.lexeme, " \t\r")
+	if f.prev != nil && comment.line == f.lastLine {
+		// A comment at the end of a line stays there.
+		f.b.WriteString(" " + text)
+	} else {
+		f.startLine(comment.line, false)
+		f.b.WriteString(text)
+	}
+	f.lastLine = comment.line
+	f.newline = true
+}
+
+// token writes the token, given the next one and whether there are comments
+// between them.
+func (f *formatter) token(token *Token, next *Token, commented bool) {
+	prev := f.prev
+
+	if token.kind == RIGHT_BRACE && f.top() == blockNesting {
+		f.pop()
+		f.indent--
+		if f.newline || prev.kind != LEFT_BRACE {
+			f.startLine(token.line, true)
+		}
+		f.write(token)
+		switch next.kind {
+		case ELSE, CATCH, FINALLY, SEMICOLON, COMMA, DOT, LEFT_PAREN, RIGHT_PAREN, RIGHT_BRACKET:
+		default:
+			f.newline = true
+		}
+		return
+	}
+
+	if f.newline {
+		f.startLine(token.line, false)
+	} else if f.space(prev, token) {
+		f.b.WriteString(" ")
+	}
+	f.write(token)
+
+	switch token.kind {
+	case LEFT_PAREN:
+		if prev != nil && prev.kind == FOR {
+			f.push(forNesting)
+		} else {
+			f.push(parenNesting)
+		}
+	case LEFT_BRACKET:
+		f.push(bracketNesting)
+	case RIGHT_PAREN, RIGHT_BRACKET:
+		f.pop()
+	case LEFT_BRACE:
+		if f.opensBlock(prev) {
+			f.push(blockNesting)
+			f.indent++
+			f.newline = next.kind != RIGHT_BRACE || commented
+			f.opened = true
+		} else {
+			f.push(mapNesting)
+		}
+	case RIGHT_BRACE:
+		f.pop()
+	case SEMICOLON:
+		f.newline = f.top() != forNesting
+	case MINUS, BANG:
+		f.unary = prev == nil || !endsOperand(prev.kind)
+	}
+}
+
+func (f *formatter) write(token *Token) {
+	f.b.WriteString(token.lexeme)
+	f.prev = token
+	f.unary, f.opened = false, false
+	f.lastLine = token.line + strings.Count(token.lexeme, "\n")
+}
+
+// opensBlock reports whether a '{' following the given token starts a block,
+// rather than a map literal.
+func (f *formatter) opensBlock(prev *Token) bool {
+	if prev == nil {
+		return true
+	}
+	switch prev.kind {
+	case RIGHT_PAREN, ELSE, TRY, FINALLY, SEMICOLON, RIGHT_BRACE, IDENTIFIER:
+		return true
+	case LEFT_BRACE:
+		return f.top() == blockNesting
+	}
+	return false
+}
+
+// space reports whether there is a space between two tokens on the same
+// line.
+func (f *formatter) space(prev *Token, token *Token) bool {
+	if prev == nil {
+		return false
+	}
+	switch token.kind {
+	case RIGHT_PAREN, RIGHT_BRACKET, COMMA, SEMICOLON, DOT, COLON:
+		return false
+	case RIGHT_BRACE:
+		// The end of a map literal.
+		return false
+	case LEFT_PAREN, LEFT_BRACKET:
+		if endsOperand(prev.kind) {
+			// A call or an index.
+			return false
+		}
+	}
+	switch prev.kind {
+	case LEFT_PAREN, LEFT_BRACKET, LEFT_BRACE, DOT:
+		return false
+	case MINUS, BANG:
+		return !f.unary
+	}
+	return true
+}
+
+// endsOperand reports whether a token of the given kind can be the last one
+// of an operand, so that a following '-' is a binary operator.
+func endsOperand(kind TokenType) bool {
+	switch kind {
+	case IDENTIFIER, NUMBER, STRING, TRUE, FALSE, NIL, THIS, RIGHT_PAREN, RIGHT_BRACKET, RIGHT_BRACE:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package lox
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat(t *testing.T) {
+	source := `// A comment.
+
+class A<B{init(x){this.x=x;}   // trailing
+  m(){return -this.x*2+!true;}}
+if(a==1){print "one";}else print"other";
+
+
+for(var i=0;i<10;i=i+1){if(i==2)continue;print i;}
+var m={"a":1,"b":[1,-2]};print m["a"];
+try{throw "x";}catch(e){print e;}finally{
+  // inside finally
+
+  print "done";
+}
+for (;;) {}
+fun (x){print x;}(-1);
+`
+	expected := `// A comment.
+
+class A < B {
+  init(x) {
+    this.x = x;
+  } // trailing
+  m() {
+    return -this.x * 2 + !true;
+  }
+}
+if (a == 1) {
+  print "one";
+} else print "other";
+
+for (var i = 0; i < 10; i = i + 1) {
+  if (i == 2) continue;
+  print i;
+}
+var m = {"a": 1, "b": [1, -2]};
+print m["a"];
+try {
+  throw "x";
+} catch (e) {
+  print e;
+} finally {
+  // inside finally
+
+  print "done";
+}
+for (;;) {}
+fun (x) {
+  print x;
+}(-1);
+`
+	formatted, diagnostics := Format("", source)
+	require.Nil(t, diagnostics)
+	require.Equal(t, expected, formatted)
+
+	formatted, diagnostics = Format("", expected)
+	require.Nil(t, diagnostics)
+	require.Equal(t, expected, formatted)
+}
+
+func TestFormatRejectsInvalidCode(t *testing.T) {
+	_, diagnostics := Format("test.lox", "print (1;")
+	require.EqualError(t, diagnostics, "[line 1] Error at ';': Expect ')' after expression.")
+}
+
+// TestFormatExamples checks that formatting the examples is idempotent and
+// doesn't change what they print.
+func TestFormatExamples(t *testing.T) {
+	paths, err := filepath.Glob("examples/*.lox")
+	require.NoError(t, err)
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		formatted, diagnostics := Format(path, string(b))
+		require.Nil(t, diagnostics)
+
+		again, diagnostics := Format(path, formatted)
+		require.Nil(t, diagnostics)
+		require.Equal(t, formatted, again, path)
+		require.Equal(t, runWith(t, TreeWalker, path, string(b)), runWith(t, TreeWalker, path, formatted), path)
+	}
+}
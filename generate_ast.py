@@ -41,12 +41,16 @@ def defineVisitor(f, baseName, types):
 
 
 def defineType(f, baseName, className, fieldList):
+    # Fields after a ";" are not set by the constructor.
+    fieldList, _, extraFieldList = fieldList.partition(";")
+    fieldList = fieldList.strip()
     fields = fieldList.split(", ")
+    extraFields = [field.strip() for field in extraFieldList.split(",") if field.strip()]
 
     f.write(f"type {className} struct {{\n")
 
     # Fields.
-    for field in fields:
+    for field in fields + extraFields:
       f.write(f"    {field}\n")
 
     f.write("}\n")
@@ -70,23 +74,39 @@ def defineType(f, baseName, className, fieldList):
     """)
 
 defineAst(outputDir, "Expr", [
-    "Assign   : name *Token, value Expr",
+    "Assign   : name *Token, value Expr; local *localSlot",
     "Binary   : left Expr, operator *Token, right Expr",
     "Call     : callee Expr, paren *Token, arguments []Expr",
+    "Get      : object Expr, name *Token",
     "Grouping : expression Expr",
+    "Index    : object Expr, bracket *Token, index Expr",
+    "Lambda   : declaration *Function",
+    "List     : bracket *Token, elements []Expr",
     "Literal  : value interface{}",
     "Logical  : left Expr, operator *Token, right Expr",
+    "Map      : brace *Token, keys []Expr, values []Expr",
+    "Set      : object Expr, name *Token, value Expr",
+    "SetIndex : object Expr, bracket *Token, index Expr, value Expr",
+    "Super    : keyword *Token, method *Token; local *localSlot",
+    "This     : keyword *Token; local *localSlot",
     "Unary    : operator *Token, right Expr",
-    "Variable : name *Token",
+    "Variable : name *Token; local *localSlot",
 ])
 
 defineAst(outputDir, "Stmt", [
+    "Assert     : keyword *Token, condition Expr, message Expr, text string",
     "Block      : statements []Stmt",
+    "Break      : keyword *Token",
+    "Class      : name *Token, superclass *Variable, methods []*Function",
+    "Continue   : keyword *Token",
     "Expression : expression Expr",
     "Function   : name *Token, params []*Token, body []Stmt",
-    "If         : condition Expr, thenBranch Stmt, elseBranch Stmt",
-    "Print      : expression Expr",
+    "If         : keyword *Token, condition Expr, thenBranch Stmt, elseBranch Stmt",
+    "Import     : keyword *Token, path *Token, name *Token, names []*Token",
+    "Print      : keyword *Token, expression Expr",
     "Return     : keyword *Token, value Expr",
+    "Throw      : keyword *Token, value Expr",
+    "Try        : keyword *Token, body *Block, catchName *Token, catchBody *Block, finallyBody *Block",
     "Var        : name *Token, initializer Expr",
-    "While      : condition Expr, body Stmt",
+    "While      : keyword *Token, condition Expr, body Stmt, increment Expr",
 ]);
@@ -1,98 +1,331 @@
 package lox
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"os"
 )
 
 type RuntimeError struct {
 	error
 	Token *Token
+	// Value is what a catch clause binds to its variable: the value given to
+	// the throw statement, or a *LoxError for errors raised by the
+	// interpreter itself.
+	Value interface{}
+	// StackTrace lists the active calls when the error was raised, starting
+	// from the innermost one. It is only set for errors returned by
+	// Interpret.
+	StackTrace []StackFrame
+
+	// fatal errors can't be caught by the script.
+	fatal bool
 }
 
+// NewRuntimeError returns a RuntimeError raised at the given token, which may
+// be nil if the error is not related to any particular place in the code.
 func NewRuntimeError(token *Token, msg string) RuntimeError {
-	return RuntimeError{error: errors.New(msg), Token: token}
+	line := 0
+	if token != nil {
+		line = token.line
+	}
+	return RuntimeError{
+		error: errors.New(msg),
+		Token: token,
+		Value: NewLoxError(msg, line),
+	}
+}
+
+func (e RuntimeError) Unwrap() error {
+	return errors.Unwrap(e.error)
+}
+
+// Render formats the error along with the offending line of source code and,
+// if the error was raised inside a function, the stack trace.
+func (e RuntimeError) Render() string {
+	var s string
+	if e.Token != nil {
+		s = render(e.Token.source, e.Token.Position(), "runtime error", e.Error())
+	} else {
+		s = "runtime error: " + e.Error() + "\n"
+	}
+	if len(e.StackTrace) > 1 {
+		s += renderStackTrace(e.StackTrace)
+	}
+	return s
+}
+
+func newThrowError(keyword *Token, value interface{}) RuntimeError {
+	msg := stringify(value)
+	if e, ok := value.(*LoxError); ok {
+		msg = e.message
+	}
+	return RuntimeError{error: errors.New(msg), Token: keyword, Value: value}
+}
+
+// ErrAssertionFailed is wrapped by the RuntimeError raised by a failed
+// assert statement, so that it can be told apart with errors.Is.
+var ErrAssertionFailed = errors.New("Assertion failed")
+
+// newAssertionError returns the error raised by a failed assert statement
+// with the given source text and message, which is nil if there is none.
+func newAssertionError(keyword *Token, text string, message interface{}) RuntimeError {
+	err := fmt.Errorf("%w: %s", ErrAssertionFailed, text)
+	if message != nil {
+		err = fmt.Errorf("%w: %s", err, stringify(message))
+	}
+	e := NewRuntimeError(keyword, err.Error())
+	e.error = err
+	return e
 }
 
 type Interpreter struct {
+	builtins    *Environment
 	globals     *Environment
 	environment *Environment
-	locals      map[Expr]int
+	frames      []callFrame
+
+	returnValue interface{}
+	thrown      RuntimeError
+
+	modules    map[string]*LoxModule
+	importing  []string
+	scriptDir  string
+	searchPath []string
+
+	stdout io.Writer
+	stderr io.Writer
+	stdin  io.Reader
+
+	ctx          context.Context
+	steps        int
+	stepLimit    int
+	maxCallDepth int
+
+	backend  Backend
+	vm       *vm
+	optimize bool
+
+	debugger Debugger
+	// catches is the number of try statements being executed whose catch
+	// clause would handle an error, and uncaughtNotified whether the
+	// debugger was notified of an uncaught error.
+	catches          int
+	uncaughtNotified bool
 }
 
-func NewInterpreter() *Interpreter {
-	globals := NewEnvironment(nil)
-	globals.define("clock", Clock{})
-	return &Interpreter{
+func NewInterpreter(options ...Option) *Interpreter {
+	builtins := NewEnvironment(nil)
+	builtins.define("clock", Clock{})
+	globals := NewEnvironment(builtins)
+	i := &Interpreter{
+		builtins:    builtins,
 		globals:     globals,
 		environment: globals,
-		locals:      make(map[Expr]int),
+		modules:     make(map[string]*LoxModule),
+		stdout:      os.Stdout,
+		stderr:      os.Stderr,
+		stdin:       os.Stdin,
+
+		ctx:          context.Background(),
+		maxCallDepth: defaultMaxCallDepth,
 	}
+	for _, option := range options {
+		option(i)
+	}
+	i.vm = newVM(i)
+	return i
+}
+
+// Interpret executes the statements, stopping at the first uncaught
+// RuntimeError, which is returned.
+func (i *Interpreter) Interpret(statements []Stmt) error {
+	return i.InterpretContext(context.Background(), statements)
 }
 
-func (i *Interpreter) Interpret(statements []Stmt) {
+// InterpretContext is like Interpret, but aborts the execution with a
+// RuntimeError when the context is done.
+func (i *Interpreter) InterpretContext(ctx context.Context, statements []Stmt) error {
+	if i.backend == BytecodeVM {
+		function, diagnostics := compileScript(statements, false)
+		if diagnostics.HasErrors() {
+			return diagnostics
+		}
+		return i.run(ctx, func() { i.vm.interpret(function, i.globals) })
+	}
+	return i.run(ctx, func() { i.executeTopLevel(statements) })
+}
+
+// run calls f, recovering from any uncaught RuntimeError.
+func (i *Interpreter) run(ctx context.Context, f func()) (err error) {
+	previous := i.ctx
+	i.ctx, i.steps = ctx, 0
+	i.uncaughtNotified = false
+	globals, environment := i.globals, i.environment
 	defer func() {
+		i.ctx = previous
 		if r := recover(); r != nil {
 			if e, ok := r.(RuntimeError); ok {
-				ReportRuntimeError(e)
+				if e.StackTrace == nil {
+					e.StackTrace = i.stackTrace(e.Token)
+				}
+				i.frames = i.frames[:0]
+				i.globals, i.environment = globals, environment
+				err = e
 				return
 			}
 			panic(r)
 		}
 	}()
-
-	for _, s := range statements {
-		i.execute(s)
-	}
+	f()
+	return nil
 }
 
-func (i *Interpreter) execute(stmt Stmt) {
-	stmt.accept(i)
+// completion is the way the execution of a statement ended. Statements other
+// than expressions return it from their visit methods, which return nil for a
+// normal completion.
+type completion int
+
+const (
+	completionNormal completion = iota
+	// completionReturn leaves the value of the return statement in
+	// Interpreter.returnValue.
+	completionReturn
+	completionBreak
+	completionContinue
+	// completionThrow leaves the error in Interpreter.thrown. Throwing out of
+	// a function turns it into a panic, since expressions can't complete
+	// abruptly.
+	completionThrow
+)
+
+func (i *Interpreter) execute(stmt Stmt) completion {
+	i.step()
+	if i.debugger != nil {
+		return i.debugExecute(stmt)
+	}
+	if c, ok := stmt.accept(i).(completion); ok {
+		return c
+	}
+	return completionNormal
 }
 
-func (i *Interpreter) resolve(expr Expr, depth int) {
-	i.locals[expr] = depth
+// executeTopLevel executes the statements of a script or module.
+func (i *Interpreter) executeTopLevel(statements []Stmt) {
+	for _, statement := range statements {
+		if i.execute(statement) == completionThrow {
+			panic(i.thrown)
+		}
+	}
 }
 
-func (i *Interpreter) executeBlock(statements []Stmt, environment *Environment) {
+// executeBlock executes the statements in the given environment, until one of
+// them completes abruptly. If a RuntimeError is raised, the environment is
+// restored by whoever recovers it.
+func (i *Interpreter) executeBlock(statements []Stmt, environment *Environment) completion {
 	previous := i.environment
-
 	i.environment = environment
-	defer func() { i.environment = previous }()
-
 	for _, statement := range statements {
-		i.execute(statement)
+		if c := i.execute(statement); c != completionNormal {
+			i.environment = previous
+			return c
+		}
 	}
+	i.environment = previous
+	return completionNormal
+}
+
+func (i *Interpreter) visitAssertStmt(stmt *Assert) interface{} {
+	if isTruthy(i.evaluate(stmt.condition)) {
+		return nil
+	}
+	var message interface{}
+	if stmt.message != nil {
+		message = i.evaluate(stmt.message)
+	}
+	panic(newAssertionError(stmt.keyword, stmt.text, message))
 }
 
 func (i *Interpreter) visitBlockStmt(stmt *Block) interface{} {
-	i.executeBlock(stmt.statements, NewEnvironment(i.environment))
+	return i.executeBlock(stmt.statements, newLocalEnvironment(i.environment, 0))
+}
+
+func (i *Interpreter) visitBreakStmt(stmt *Break) interface{} {
+	return completionBreak
+}
+
+func (i *Interpreter) visitClassStmt(stmt *Class) interface{} {
+	var superclass *LoxClass
+	if stmt.superclass != nil {
+		var ok bool
+		superclass, ok = i.evaluate(stmt.superclass).(*LoxClass)
+		if !ok {
+			panic(NewRuntimeError(stmt.superclass.name, "Superclass must be a class."))
+		}
+	}
+
+	if stmt.superclass != nil {
+		i.environment = newLocalEnvironment(i.environment, 1)
+		i.environment.define("super", superclass)
+	}
+
+	methods := make(map[string]*LoxFunction)
+	for _, method := range stmt.methods {
+		function := NewLoxFunction(method, i.environment, method.name.lexeme == "init", i.globals)
+		methods[method.name.lexeme] = function
+	}
+
+	class := NewLoxClass(stmt.name.lexeme, superclass, methods)
+
+	if superclass != nil {
+		i.environment = i.environment.enclosing
+	}
+
+	i.environment.define(stmt.name.lexeme, class)
 	return nil
 }
 
+func (i *Interpreter) visitContinueStmt(stmt *Continue) interface{} {
+	return completionContinue
+}
+
 func (i *Interpreter) visitExpressionStmt(stmt *Expression) interface{} {
 	i.evaluate(stmt.expression)
 	return nil
 }
 
 func (i *Interpreter) visitFunctionStmt(stmt *Function) interface{} {
-	function := NewLoxFunction(stmt, i.environment)
+	function := NewLoxFunction(stmt, i.environment, false, i.globals)
 	i.environment.define(stmt.name.lexeme, function)
 	return nil
 }
 
 func (i *Interpreter) visitIfStmt(stmt *If) interface{} {
 	if isTruthy(i.evaluate(stmt.condition)) {
-		i.execute(stmt.thenBranch)
+		return i.execute(stmt.thenBranch)
 	} else if stmt.elseBranch != nil {
-		i.execute(stmt.elseBranch)
+		return i.execute(stmt.elseBranch)
+	}
+	return nil
+}
+
+func (i *Interpreter) visitImportStmt(stmt *Import) interface{} {
+	module := i.importModule(stmt.path)
+	if stmt.name != nil {
+		i.environment.define(stmt.name.lexeme, module)
+		return nil
+	}
+	for _, name := range stmt.names {
+		i.environment.define(name.lexeme, module.get(name))
 	}
 	return nil
 }
 
 func (i *Interpreter) visitPrintStmt(stmt *Print) interface{} {
 	value := i.evaluate(stmt.expression)
-	fmt.Printf("%s\n", stringify(value))
+	fmt.Fprintf(i.stdout, "%s\n", stringify(value))
 	return nil
 }
 
@@ -101,7 +334,64 @@ func (i *Interpreter) visitReturnStmt(stmt *Return) interface{} {
 	if stmt.value != nil {
 		value = i.evaluate(stmt.value)
 	}
-	panic(returnSignal{value})
+	i.returnValue = value
+	return completionReturn
+}
+
+func (i *Interpreter) visitThrowStmt(stmt *Throw) interface{} {
+	i.thrown = newThrowError(stmt.keyword, i.evaluate(stmt.value))
+	return completionThrow
+}
+
+func (i *Interpreter) visitTryStmt(stmt *Try) interface{} {
+	c := i.tryBlock(stmt.body.statements, newLocalEnvironment(i.environment, 0), stmt.catchBody != nil)
+
+	if c == completionThrow && stmt.catchBody != nil {
+		environment := newLocalEnvironment(i.environment, 1)
+		environment.define(stmt.catchName.lexeme, i.thrown.Value)
+		if stmt.finallyBody != nil {
+			c = i.tryBlock([]Stmt{stmt.catchBody}, environment, false)
+		} else {
+			c = i.executeBlock([]Stmt{stmt.catchBody}, environment)
+		}
+	}
+
+	if stmt.finallyBody != nil {
+		// Unless the finally clause completes abruptly, the try statement
+		// completes like its body or catch clause did.
+		returnValue, thrown := i.returnValue, i.thrown
+		if f := i.execute(stmt.finallyBody); f != completionNormal {
+			return f
+		}
+		i.returnValue, i.thrown = returnValue, thrown
+	}
+	return c
+}
+
+// tryBlock executes the statements in the given environment, turning any
+// RuntimeError raised while doing so into a throw completion. catches
+// reports whether a catch clause is going to handle it.
+func (i *Interpreter) tryBlock(statements []Stmt, environment *Environment, catches bool) (c completion) {
+	depth, previous, globals := len(i.frames), i.environment, i.globals
+	if catches {
+		i.catches++
+	}
+	defer func() {
+		if catches {
+			i.catches--
+		}
+		if r := recover(); r != nil {
+			if e, ok := r.(RuntimeError); ok && !e.fatal {
+				i.frames = i.frames[:depth]
+				i.environment, i.globals = previous, globals
+				i.thrown = e
+				c = completionThrow
+				return
+			}
+			panic(r)
+		}
+	}()
+	return i.executeBlock(statements, environment)
 }
 
 func (i *Interpreter) visitVarStmt(stmt *Var) interface{} {
@@ -115,7 +405,15 @@ func (i *Interpreter) visitVarStmt(stmt *Var) interface{} {
 
 func (i *Interpreter) visitWhileStmt(stmt *While) interface{} {
 	for isTruthy(i.evaluate(stmt.condition)) {
-		i.execute(stmt.body)
+		switch c := i.execute(stmt.body); c {
+		case completionBreak:
+			return nil
+		case completionReturn, completionThrow:
+			return c
+		}
+		if stmt.increment != nil {
+			i.evaluate(stmt.increment)
+		}
 	}
 	return nil
 }
@@ -123,8 +421,8 @@ func (i *Interpreter) visitWhileStmt(stmt *While) interface{} {
 func (i *Interpreter) visitAssignExpr(expr *Assign) interface{} {
 	value := i.evaluate(expr.value)
 
-	if distance, ok := i.locals[expr]; ok {
-		i.environment.assignAt(distance, expr.name, value)
+	if expr.local != nil {
+		i.environment.assignAt(expr.name, expr.local, value)
 	} else {
 		i.globals.assign(expr.name, value)
 	}
@@ -186,18 +484,67 @@ func (i *Interpreter) visitCallExpr(expr *Call) interface{} {
 	}
 
 	if function, ok := callee.(LoxCallable); ok {
-		if len(arguments) != function.Arity() {
+		if arity := function.Arity(); arity >= 0 && len(arguments) != arity {
 			panic(NewRuntimeError(expr.paren, fmt.Sprintf("Expected %d arguments but got %d.", function.Arity(), len(arguments))))
 		}
-		return function.Call(i, arguments)
+		if i.maxCallDepth > 0 && len(i.frames) >= i.maxCallDepth {
+			panic(NewRuntimeError(expr.paren, "Stack overflow."))
+		}
+		// The frame is not popped if the call panics, so that it is still
+		// there to build the stack trace when the error is recovered.
+		i.frames = append(i.frames, callFrame{callableName(function), expr.paren, i.environment})
+		result := function.Call(i, arguments)
+		i.frames = i.frames[:len(i.frames)-1]
+		return result
 	}
 	panic(NewRuntimeError(expr.paren, "Can only call functions and classes."))
 }
 
+func (i *Interpreter) visitGetExpr(expr *Get) interface{} {
+	object := i.evaluate(expr.object)
+	switch object := object.(type) {
+	case *LoxInstance:
+		return object.get(expr.name)
+	case *LoxList:
+		return object.get(expr.name)
+	case *LoxMap:
+		return object.get(expr.name)
+	case *LoxError:
+		return object.get(expr.name)
+	case *LoxModule:
+		return object.get(expr.name)
+	}
+	panic(NewRuntimeError(expr.name, "Only instances have properties."))
+}
+
 func (i *Interpreter) visitGroupingExpr(g *Grouping) interface{} {
 	return i.evaluate(g.expression)
 }
 
+func (i *Interpreter) visitIndexExpr(expr *Index) interface{} {
+	object := i.evaluate(expr.object)
+	index := i.evaluate(expr.index)
+	switch object := object.(type) {
+	case *LoxList:
+		return object.getIndex(expr.bracket, index)
+	case *LoxMap:
+		return object.getIndex(expr.bracket, index)
+	}
+	panic(NewRuntimeError(expr.bracket, "Only lists and maps can be indexed."))
+}
+
+func (i *Interpreter) visitLambdaExpr(expr *Lambda) interface{} {
+	return NewLoxFunction(expr.declaration, i.environment, false, i.globals)
+}
+
+func (i *Interpreter) visitListExpr(expr *List) interface{} {
+	elements := make([]interface{}, 0, len(expr.elements))
+	for _, element := range expr.elements {
+		elements = append(elements, i.evaluate(element))
+	}
+	return NewLoxList(elements)
+}
+
 func (i *Interpreter) visitLiteralExpr(l *Literal) interface{} {
 	return l.value
 }
@@ -218,6 +565,59 @@ func (i *Interpreter) visitLogicalExpr(expr *Logical) interface{} {
 	return i.evaluate(expr.right)
 }
 
+func (i *Interpreter) visitMapExpr(expr *Map) interface{} {
+	m := NewLoxMap()
+	for k := range expr.keys {
+		key := i.evaluate(expr.keys[k])
+		m.setIndex(expr.brace, key, i.evaluate(expr.values[k]))
+	}
+	return m
+}
+
+func (i *Interpreter) visitSetExpr(expr *Set) interface{} {
+	object := i.evaluate(expr.object)
+	instance, ok := object.(*LoxInstance)
+	if !ok {
+		panic(NewRuntimeError(expr.name, "Only instances have fields."))
+	}
+	value := i.evaluate(expr.value)
+	instance.set(expr.name, value)
+	return value
+}
+
+func (i *Interpreter) visitSetIndexExpr(expr *SetIndex) interface{} {
+	object := i.evaluate(expr.object)
+	index := i.evaluate(expr.index)
+	value := i.evaluate(expr.value)
+	switch object := object.(type) {
+	case *LoxList:
+		object.setIndex(expr.bracket, index, value)
+		return value
+	case *LoxMap:
+		object.setIndex(expr.bracket, index, value)
+		return value
+	}
+	panic(NewRuntimeError(expr.bracket, "Only lists and maps can be indexed."))
+}
+
+func (i *Interpreter) visitSuperExpr(expr *Super) interface{} {
+	superclass := i.environment.getAt(expr.keyword, expr.local).(*LoxClass)
+
+	// "this" is always one level nearer than "super"'s environment.
+	this := localSlot{depth: expr.local.depth - 1, slot: 0}
+	object := i.environment.getAt(expr.keyword, &this).(*LoxInstance)
+
+	method := superclass.findMethod(expr.method.lexeme)
+	if method == nil {
+		panic(NewRuntimeError(expr.method, "Undefined property '"+expr.method.lexeme+"'."))
+	}
+	return method.bind(object)
+}
+
+func (i *Interpreter) visitThisExpr(expr *This) interface{} {
+	return i.lookUpVariable(expr.keyword, expr.local)
+}
+
 func (i *Interpreter) visitUnaryExpr(u *Unary) interface{} {
 	right := i.evaluate(u.right)
 	switch u.operator.kind {
@@ -230,12 +630,12 @@ func (i *Interpreter) visitUnaryExpr(u *Unary) interface{} {
 }
 
 func (i *Interpreter) visitVariableExpr(expr *Variable) interface{} {
-	return i.lookUpVariable(expr.name, expr)
+	return i.lookUpVariable(expr.name, expr.local)
 }
 
-func (i *Interpreter) lookUpVariable(name *Token, expr Expr) interface{} {
-	if distance, ok := i.locals[expr]; ok {
-		return i.environment.getAt(distance, name.lexeme)
+func (i *Interpreter) lookUpVariable(name *Token, local *localSlot) interface{} {
+	if local != nil {
+		return i.environment.getAt(name, local)
 	}
 	return i.globals.get(name)
 }
@@ -0,0 +1,383 @@
+package lox
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// scriptTest is a script, along with what it should print and the error it
+// should raise, if any.
+type scriptTest struct {
+	source string
+	output string
+	err    string
+}
+
+// runScripts runs each script on both backends, and checks its output and
+// error.
+func runScripts(t *testing.T, tests []scriptTest) {
+	t.Helper()
+	runScriptsAt(t, "", tests)
+}
+
+// runScriptsAt is like runScripts, but runs the scripts as if they were the
+// file at the given path, which imports are resolved from.
+func runScriptsAt(t *testing.T, path string, tests []scriptTest) {
+	t.Helper()
+	for _, test := range tests {
+		for _, backend := range []Backend{TreeWalker, BytecodeVM} {
+			var out strings.Builder
+			i := NewInterpreter(WithBackend(backend), WithStdout(&out))
+			if path != "" {
+				i.SetScriptPath(path)
+			}
+			_, err := i.Eval(test.source, "")
+			if test.err == "" {
+				require.NoError(t, err, test.source)
+			} else {
+				require.EqualError(t, err, test.err, test.source)
+			}
+			require.Equal(t, test.output, out.String(), test.source)
+		}
+	}
+}
+
+func TestClasses(t *testing.T) {
+	runScripts(t, []scriptTest{
+		{source: `class A {} print A; print A();`, output: "A\nA instance\n"},
+		{source: `class Point {
+  init(x, y) { this.x = x; this.y = y; }
+  sum() { return this.x + this.y; }
+}
+var p = Point(1, 2);
+print p.sum();
+p.x = 10;
+print p.sum();`, output: "3\n12\n"},
+		{source: `class A { m() { return this.v; } }
+var a = A(); a.v = "bound";
+var m = a.m;
+a.v = "changed";
+print m();`, output: "changed\n"},
+		{source: `class A { init() { this.n = 1; return; } }
+var a = A();
+print a.init().n;`, output: "1\n"},
+		{source: `class A { f() { return "method"; } }
+fun f() { return "field"; }
+var a = A();
+a.f = f;
+print a.f();`, output: "field\n"},
+		{source: `class A {} A().missing;`, err: "Undefined property 'missing'."},
+		{source: `var x = 1; x.y;`, err: "Only instances have properties."},
+		{source: `"s".y = 1;`, err: "Only instances have fields."},
+		{source: `class A { init(x) {} } A();`, err: "Expected 1 arguments but got 0."},
+		{source: `print this;`, err: "[line 1] Error at 'this': Can't use 'this' outside of a class."},
+		{source: `class A { init() { return 1; } }`, err: "[line 1] Error at 'return': Can't return a value from an initializer."},
+	})
+}
+
+func TestInheritance(t *testing.T) {
+	runScripts(t, []scriptTest{
+		{source: `class A { m() { return "A.m"; } n() { return "A.n"; } }
+class B < A { m() { return "B.m"; } }
+class C < B {}
+var c = C();
+print c.m();
+print c.n();`, output: "B.m\nA.n\n"},
+		{source: `class A { init(x) { this.x = x; } describe() { return "A" + this.x; } }
+class B < A {
+  init() { super.init("b"); }
+  describe() { return "B" + super.describe(); }
+}
+print B().describe();`, output: "BAb\n"},
+		{source: `class A { m() { return "A"; } }
+class B < A { m() { var f = super.m; return f() + "B"; } }
+class C < B { m() { return super.m() + "C"; } }
+print C().m();`, output: "ABC\n"},
+		{source: `class A {} class B < A { m() { return super.missing(); } } B().m();`, err: "Undefined property 'missing'."},
+		{source: `var NotAClass = "so not"; class A < NotAClass {}`, err: "Superclass must be a class."},
+		{source: `class A < A {}`, err: "[line 1] Error at 'A': A class can't inherit from itself."},
+		{source: `class A { m() { super.m(); } }`, err: "[line 1] Error at 'super': Can't use 'super' in a class with no superclass."},
+		{source: `fun f() { super.m(); }`, err: "[line 1] Error at 'super': Can't use 'super' outside of a class."},
+	})
+}
+
+func TestLists(t *testing.T) {
+	runScripts(t, []scriptTest{
+		{source: `print []; print [1, "a", nil, true, [2]];`, output: "[]\n[1, \"a\", nil, true, [2]]\n"},
+		{source: `var xs = [1, 2, 3];
+xs[0] = xs[1] + xs[2];
+print xs;
+print xs[0];
+print xs.length();`, output: "[5, 2, 3]\n5\n3\n"},
+		{source: `var xs = [];
+xs.append(1);
+xs.append("two");
+print xs.pop();
+print xs;`, output: "two\n[1]\n"},
+		{source: `var xs = [[1, 2], [3]]; xs[1][0] = 4; print xs[1][0] + xs[0][1];`, output: "6\n"},
+		{source: `var a = [1]; var b = a; b[0] = 2; print a; print a == b; print [1] == [1];`, output: "[2]\ntrue\nfalse\n"},
+		{source: `[1, 2][2];`, err: "List index out of range."},
+		{source: `[1, 2][-1];`, err: "List index out of range."},
+		{source: `[1, 2][0.5];`, err: "List index must be an integer."},
+		{source: `var xs = [1]; xs["0"] = 1;`, err: "List index must be an integer."},
+		{source: `[].pop();`, err: "Can't pop from an empty list."},
+		{source: `[].missing;`, err: "Undefined property 'missing'."},
+		{source: `"abc"[0];`, err: "Only lists and maps can be indexed."},
+		{source: `[1, 2;`, err: "[line 1] Error at ';': Expect ']' after list elements."},
+	})
+}
+
+func TestMaps(t *testing.T) {
+	runScripts(t, []scriptTest{
+		{source: `print {}; print {"a": 1, 2: [nil], true: {}};`, output: "{}\n{\"a\": 1, 2: [nil], true: {}}\n"},
+		{source: `var m = {"a": 1};
+m["b"] = 2;
+m["a"] = m["a"] + m["b"];
+print m;
+print m.length();`, output: "{\"a\": 3, \"b\": 2}\n2\n"},
+		{source: `var m = {1: "one", nil: "nil"};
+print m.has(1); print m.has("1"); print m.has(nil);
+print m.delete(1); print m.delete(1);
+print m.keys(); print m.values();`, output: "true\nfalse\ntrue\ntrue\nfalse\n[nil]\n[\"nil\"]\n"},
+		{source: `var k = [1]; var m = {k: "list"}; print m[k]; print m.has([1]);`, output: "list\nfalse\n"},
+		{source: `var m = {1: "a"}; m[1.0] = "b"; print m;`, output: "{1: \"b\"}\n"},
+		{source: `var m = {"a": 1, "b": 2, "c": 3};
+m.delete("a");
+m["d"] = 4;
+m["b"] = 5;
+print m; print m.keys(); print m.values();
+m.delete("d");
+print m;`, output: "{\"b\": 5, \"c\": 3, \"d\": 4}\n[\"b\", \"c\", \"d\"]\n[5, 3, 4]\n{\"b\": 5, \"c\": 3}\n"},
+		{source: `var m = {1: "a"};
+var x = 0/0;
+print m.has(x); print m.delete(x);
+try { m[x] = 1; } catch (e) { print e.message; print e.line; }
+print m;`, output: "false\nfalse\nMap key can't be NaN.\n4\n{1: \"a\"}\n"},
+		{source: `var m = {}; m[0/0] = 1;`, err: "Map key can't be NaN."},
+		{source: `var m = {0/0: 1};`, err: "Map key can't be NaN."},
+		{source: `var m = {"a": 1}; m["b"];`, err: `Undefined key "b".`},
+		{source: `var m = {}; m[nil];`, err: "Undefined key nil."},
+		{source: `var m = {}; m.missing;`, err: "Undefined property 'missing'."},
+		{source: `var m = {"a" 1};`, err: "[line 1] Error at '1': Expect ':' after map key."},
+		{source: `var m = {"a": 1;`, err: "[line 1] Error at ';': Expect '}' after map entries."},
+	})
+}
+
+func TestBreakContinue(t *testing.T) {
+	runScripts(t, []scriptTest{
+		{source: `var i = 0;
+while (true) { i = i + 1; if (i == 3) break; }
+print i;`, output: "3\n"},
+		{source: `for (var i = 0; i < 5; i = i + 1) { if (i == 1 or i == 3) continue; print i; }`, output: "0\n2\n4\n"},
+		{source: `var i = 0;
+while (i < 4) { i = i + 1; if (i == 2) continue; print i; }`, output: "1\n3\n4\n"},
+		{source: `for (var i = 0; i < 3; i = i + 1) {
+  for (var j = 0; j < 3; j = j + 1) { if (j == 1) break; print i + j * 10; }
+  if (i == 1) break;
+}`, output: "0\n1\n"},
+		{source: `var fs = [];
+for (var i = 0; i < 3; i = i + 1) {
+  var j = i;
+  if (i == 1) continue;
+  fun f() { return j; }
+  fs.append(f);
+}
+print fs[0]() + fs[1]();`, output: "2\n"},
+		{source: `break;`, err: "[line 1] Error at 'break': Can't use 'break' outside of a loop."},
+		{source: `continue;`, err: "[line 1] Error at 'continue': Can't use 'continue' outside of a loop."},
+		{source: `while (true) { fun f() { break; } }`, err: "[line 1] Error at 'break': Can't use 'break' outside of a loop."},
+		{source: `while (true) break`, err: "[line 1] Error at end: Expect ';' after 'break'."},
+	})
+}
+
+func TestLambdas(t *testing.T) {
+	runScripts(t, []scriptTest{
+		{source: `var add = fun (a, b) { return a + b; }; print add(1, 2);`, output: "3\n"},
+		{source: `print (fun () { return "now"; })();`, output: "now\n"},
+		{source: `fun twice(f, x) { return f(f(x)); } print twice(fun (n) { return n * 2; }, 3);`, output: "12\n"},
+		{source: `fun counter() { var n = 0; return fun () { n = n + 1; return n; }; }
+var c = counter(); c(); print c();`, output: "2\n"},
+		{source: `print fun () {};`, output: "<fn>\n"},
+		{source: `var f = fun (a) {}; f();`, err: "Expected 1 arguments but got 0."},
+		{source: `var f = fun (a, a) {};`, err: "[line 1] Error at 'a': Already variable with this name in this scope."},
+		{source: `var f = fun { };`, err: "[line 1] Error at '{': Expect '(' after 'fun'."},
+	})
+}
+
+func TestExceptions(t *testing.T) {
+	runScripts(t, []scriptTest{
+		{source: `try { throw "boom"; } catch (e) { print e; }`, output: "boom\n"},
+		{source: `fun f() { throw [1, 2]; } try { f(); print "unreachable"; } catch (e) { print e[1]; }`, output: "2\n"},
+		{source: `try { print "body"; } finally { print "finally"; }`, output: "body\nfinally\n"},
+		{source: `try { throw 1; } catch (e) { print "caught"; } finally { print "finally"; }`, output: "caught\nfinally\n"},
+		{source: `try { try { throw 1; } catch (e) { throw e + 1; } } catch (e) { print e; }`, output: "2\n"},
+		{source: `try { [].pop(); } catch (e) { print e.message; print e.line; }`, output: "Can't pop from an empty list.\n1\n"},
+		{source: `try {} catch (e) {} print e;`, err: "Undefined variable 'e'."},
+		{source: `throw "uncaught";`, err: "uncaught"},
+		{source: `try { throw 1; } finally { print "finally"; }`, output: "finally\n", err: "1"},
+		{source: `try { print 1; }`, err: "[line 1] Error at end: Expect 'catch' or 'finally' after try block."},
+		{source: `try {} catch e {}`, err: "[line 1] Error at 'e': Expect '(' after 'catch'."},
+	})
+}
+
+func TestImports(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"lib.lox":     `print "loading lib"; var x = 1; fun double(n) { return n * 2; }`,
+		"a.lox":       `import "b.lox";`,
+		"b.lox":       `import "a.lox";`,
+		"bad.lox":     `var = 1;`,
+		"my-lib.lox":  `var y = 2;`,
+		"thrower.lox": `throw "from module";`,
+	}
+	for name, source := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(source), 0644))
+	}
+
+	runScriptsAt(t, filepath.Join(dir, "main.lox"), []scriptTest{
+		{source: `import "lib.lox"; print lib.x; print lib.double(2); print lib;`, output: "loading lib\n1\n4\n<module lib>\n"},
+		{source: `import "lib.lox"; import "lib.lox" as l; print l.x;`, output: "loading lib\n1\n"},
+		{source: `import "lib.lox" for x, double; print double(x);`, output: "loading lib\n2\n"},
+		{source: `import "my-lib.lox" as m; print m.y;`, output: "2\n"},
+		{source: `import "lib.lox"; print lib.y;`, output: "loading lib\n", err: "Module 'lib' has no top-level 'y'."},
+		{source: `import "lib.lox" for y;`, output: "loading lib\n", err: "Module 'lib' has no top-level 'y'."},
+		{source: `import "missing.lox";`, err: "Module 'missing.lox' not found."},
+		{source: `import "a.lox";`, err: "Import cycle: a.lox -> b.lox -> a.lox."},
+		{source: `import "bad.lox";`, err: "Could not load module 'bad.lox':\n[line 1] Error at '=': Expect variable name."},
+		{source: `import "thrower.lox";`, err: "from module"},
+		{source: `import "my-lib.lox";`, err: "[line 1] Error at '\"my-lib.lox\"': Module file name is not a valid identifier; use 'as' to name it."},
+		{source: `import lib;`, err: "[line 1] Error at 'lib': Expect module path after 'import'."},
+	})
+}
+
+func TestDiagnostics(t *testing.T) {
+	runScripts(t, []scriptTest{
+		{source: "print 1 +;", err: "[line 1] Error at ';': Expect expression."},
+		{source: "var a = 1\nprint a;", err: "[line 2] Error at 'print': Expect ';' after variable declaration."},
+		{source: "print @;", err: "[line 1] Error: Unexpected character.\n[line 1] Error at ';': Expect expression."},
+		{source: "\"open", err: "[line 1] Error: Unterminated string."},
+		{source: "var = 1;\nprint );\nfun f( {}", err: "[line 1] Error at '=': Expect variable name.\n" +
+			"[line 2] Error at ')': Expect expression.\n" +
+			"[line 3] Error at '{': Expect parameter name."},
+		{source: "{ var a = 1; var a = 2; print a; }\nreturn;", err: "[line 1] Error at 'a': Already variable with this name in this scope.\n" +
+			"[line 2] Error at 'return': Can't return from top-level code."},
+		{source: "{ var a = a; }", err: "[line 1] Error at 'a': Can't read local variable in its own initializer."},
+		{source: "print 1;\nprint this;", err: "[line 2] Error at 'this': Can't use 'this' outside of a class."},
+	})
+
+	_, err := NewInterpreter().Eval("var = 1;\nprint @;", "test.lox")
+	require.IsType(t, Diagnostics{}, err)
+	diagnostics := err.(Diagnostics)
+	require.True(t, diagnostics.HasErrors())
+	require.Len(t, diagnostics, 3)
+	for _, d := range diagnostics {
+		require.Equal(t, SeverityError, d.Severity)
+	}
+	// The whole source is scanned before it is parsed.
+	require.Equal(t, "Unexpected character.", diagnostics[0].Message)
+	require.Nil(t, diagnostics[0].Token)
+	require.Equal(t, "Expect variable name.", diagnostics[1].Message)
+	require.Equal(t, "=", diagnostics[1].Token.Lexeme())
+
+	// Warnings don't prevent the code from running.
+	_, err = NewInterpreter().Eval("{ var unused = 1; }", "test.lox")
+	require.NoError(t, err)
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		source   string
+		rendered string
+	}{
+		{"var a = ;", "test.lox:1:9: error: Expect expression.\n" +
+			" 1 | var a = ;\n" +
+			"   |         ^\n"},
+		{"print 1;\nprint undefined + 1;", "1\ntest.lox:2:7: runtime error: Undefined variable 'undefined'.\n" +
+			" 2 | print undefined + 1;\n" +
+			"   |       ^~~~~~~~~\n"},
+		{"print \"ñandú\" + nil;", "test.lox:1:15: runtime error: Operands must be two numbers or two strings.\n" +
+			" 1 | print \"ñandú\" + nil;\n" +
+			"   |               ^\n"},
+		{"{\n\tprint -\"a\";\n}", "test.lox:2:8: runtime error: Operand must be a number.\n" +
+			" 2 | \tprint -\"a\";\n" +
+			"   | \t      ^\n"},
+		{"print 1;\r\nprint #;", "test.lox:2:7: error: Unexpected character.\n" +
+			" 2 | print #;\n" +
+			"   |       ^\n" +
+			"test.lox:2:8: error: Expect expression.\n" +
+			" 2 | print #;\n" +
+			"   |        ^\n"},
+		{"print \"a\nb", "test.lox:1:7: error: Unterminated string.\n" +
+			" 1 | print \"a\n" +
+			"   |       ^~\n" +
+			"test.lox:2:2: error: Expect expression.\n" +
+			" 2 | b\n" +
+			"   |  ^\n"},
+		{"print (1 + 2", "test.lox:1:13: error: Expect ')' after expression.\n" +
+			" 1 | print (1 + 2\n" +
+			"   |             ^\n"},
+	}
+	for _, test := range tests {
+		for _, backend := range []Backend{TreeWalker, BytecodeVM} {
+			require.Equal(t, test.rendered, runWith(t, backend, "test.lox", test.source), test.source)
+		}
+	}
+
+	_, err := NewInterpreter().Eval("var s = \"ñ\";\n  s = s + 1;", "test.lox")
+	require.Equal(t, Position{Filename: "test.lox", Line: 2, Column: 9, Offset: 22, End: 23}, err.(RuntimeError).Token.Position())
+}
+
+func TestStackTraces(t *testing.T) {
+	tests := []struct {
+		source   string
+		rendered string
+	}{
+		{"print -nil;", "test.lox:1:7: runtime error: Operand must be a number.\n" +
+			" 1 | print -nil;\n" +
+			"   |       ^\n"},
+		{"fun a() { b(); }\nfun b() {\n  [].pop();\n}\na();", "test.lox:3:6: runtime error: Can't pop from an empty list.\n" +
+			" 3 |   [].pop();\n" +
+			"   |      ^~~\n" +
+			"Traceback (most recent call first):\n" +
+			"  test.lox:3:6 in pop()\n" +
+			"  test.lox:3:10 in b()\n" +
+			"  test.lox:1:13 in a()\n" +
+			"  test.lox:5:3 in script\n"},
+		{"class A { init() { throw \"no\"; } }\nvar f = fun () { A(); };\nf();", "test.lox:1:20: runtime error: no\n" +
+			" 1 | class A { init() { throw \"no\"; } }\n" +
+			"   |                    ^~~~~\n" +
+			"Traceback (most recent call first):\n" +
+			"  test.lox:1:20 in A()\n" +
+			"  test.lox:2:20 in <anonymous>()\n" +
+			"  test.lox:3:3 in script\n"},
+		{"fun f() { f(); }\nf();", "test.lox:1:13: runtime error: Stack overflow.\n" +
+			" 1 | fun f() { f(); }\n" +
+			"   |             ^\n" +
+			"Traceback (most recent call first):\n" +
+			"  test.lox:1:13 in f()\n" +
+			"  test.lox:1:13 in f()\n" +
+			"  test.lox:1:13 in f()\n" +
+			"  [Previous frame repeated 61 more times]\n" +
+			"  test.lox:2:3 in script\n"},
+	}
+	for _, test := range tests {
+		for _, backend := range []Backend{TreeWalker, BytecodeVM} {
+			var out strings.Builder
+			i := NewInterpreter(WithBackend(backend), WithStdout(&out), WithStderr(&out), WithMaxCallDepth(64))
+			_, err := i.Eval(test.source, "test.lox")
+			require.Error(t, err, test.source)
+			i.Report(err)
+			require.Equal(t, test.rendered, out.String(), test.source)
+		}
+	}
+
+	_, err := NewInterpreter().Eval("fun f() { throw 1; }\ntry { f(); } catch (e) {}\nf();", "")
+	require.Equal(t, []StackFrame{
+		{"f", Position{Line: 1, Column: 11, Offset: 10, End: 15}},
+		{"script", Position{Line: 3, Column: 3, Offset: 49, End: 50}},
+	}, err.(RuntimeError).StackTrace)
+}
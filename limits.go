@@ -0,0 +1,47 @@
+package lox
+
+import "fmt"
+
+// defaultMaxCallDepth is deep enough for reasonable recursive code, while
+// keeping the Go stack well below its limit.
+const defaultMaxCallDepth = 10000
+
+// contextCheckInterval is how many steps are executed between checks of the
+// interpreter's context.
+const contextCheckInterval = 1024
+
+// WithStepLimit sets the maximum number of statements (or instructions, with
+// the BytecodeVM backend) that a single call to Eval or Interpret can execute,
+// or 0 for no limit (the default). Exceeding the limit aborts the execution
+// with a RuntimeError that the script can't catch.
+func WithStepLimit(steps int) Option {
+	return func(i *Interpreter) { i.stepLimit = steps }
+}
+
+// WithMaxCallDepth sets the maximum number of nested calls, or 0 for no
+// limit. Exceeding the limit raises a "Stack overflow." RuntimeError.
+func WithMaxCallDepth(depth int) Option {
+	return func(i *Interpreter) { i.maxCallDepth = depth }
+}
+
+// step is called before executing each statement or instruction, to enforce
+// the step limit and the cancellation of the context.
+func (i *Interpreter) step() {
+	i.steps++
+	if i.stepLimit > 0 && i.steps > i.stepLimit {
+		panic(newFatalError(fmt.Errorf("Step limit exceeded.")))
+	}
+	if i.steps%contextCheckInterval == 0 {
+		if err := i.ctx.Err(); err != nil {
+			panic(newFatalError(fmt.Errorf("Execution interrupted: %w.", err)))
+		}
+	}
+}
+
+// newFatalError returns a RuntimeError that can't be caught by the script.
+func newFatalError(err error) RuntimeError {
+	e := NewRuntimeError(nil, err.Error())
+	e.error = err
+	e.fatal = true
+	return e
+}
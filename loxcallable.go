@@ -2,5 +2,23 @@ package lox
 
 type LoxCallable interface {
 	Call(interpreter *Interpreter, arguments []interface{}) interface{}
+	// Arity returns the number of arguments expected by Call, or -1 if it
+	// accepts any number of arguments (and checks them by itself).
 	Arity() int
 }
+
+// nativeMethod is a built-in method bound to a receiver, such as the methods
+// of lists.
+type nativeMethod struct {
+	name  *Token
+	arity int
+	call  func(arguments []interface{}) interface{}
+}
+
+func (m *nativeMethod) Arity() int { return m.arity }
+
+func (m *nativeMethod) Call(interpreter *Interpreter, arguments []interface{}) interface{} {
+	return m.call(arguments)
+}
+
+func (m *nativeMethod) String() string { return "<native fn " + m.name.lexeme + ">" }
@@ -0,0 +1,38 @@
+package lox
+
+type LoxClass struct {
+	name       string
+	superclass *LoxClass
+	methods    map[string]*LoxFunction
+}
+
+func NewLoxClass(name string, superclass *LoxClass, methods map[string]*LoxFunction) *LoxClass {
+	return &LoxClass{name, superclass, methods}
+}
+
+func (c *LoxClass) findMethod(name string) *LoxFunction {
+	if method, ok := c.methods[name]; ok {
+		return method
+	}
+	if c.superclass != nil {
+		return c.superclass.findMethod(name)
+	}
+	return nil
+}
+
+func (c *LoxClass) Arity() int {
+	if initializer := c.findMethod("init"); initializer != nil {
+		return initializer.Arity()
+	}
+	return 0
+}
+
+func (c *LoxClass) Call(interpreter *Interpreter, arguments []interface{}) interface{} {
+	instance := NewLoxInstance(c)
+	if initializer := c.findMethod("init"); initializer != nil {
+		initializer.bind(instance).Call(interpreter, arguments)
+	}
+	return instance
+}
+
+func (c *LoxClass) String() string { return c.name }
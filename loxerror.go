@@ -0,0 +1,24 @@
+package lox
+
+// LoxError is the value bound by a catch clause when the interpreter raises a
+// RuntimeError, e.g. because of a type error.
+type LoxError struct {
+	message string
+	line    int
+}
+
+func NewLoxError(message string, line int) *LoxError {
+	return &LoxError{message, line}
+}
+
+func (e *LoxError) get(name *Token) interface{} {
+	switch name.lexeme {
+	case "message":
+		return e.message
+	case "line":
+		return float64(e.line)
+	}
+	panic(NewRuntimeError(name, "Undefined property '"+name.lexeme+"'."))
+}
+
+func (e *LoxError) String() string { return e.message }
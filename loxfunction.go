@@ -1,39 +1,53 @@
 package lox
 
-type returnSignal struct {
-	value interface{}
+type LoxFunction struct {
+	declaration   *Function
+	closure       *Environment
+	isInitializer bool
+	// globals is the top-level environment of the module where the function
+	// was declared.
+	globals *Environment
 }
 
-type LoxFunction struct {
-	declaration *Function
-	closure     *Environment
+func NewLoxFunction(declaration *Function, closure *Environment, isInitializer bool, globals *Environment) *LoxFunction {
+	return &LoxFunction{declaration, closure, isInitializer, globals}
 }
 
-func NewLoxFunction(declaration *Function, closure *Environment) *LoxFunction {
-	return &LoxFunction{declaration, closure}
+func (f *LoxFunction) bind(instance *LoxInstance) *LoxFunction {
+	environment := newLocalEnvironment(f.closure, 1)
+	environment.define("this", instance)
+	return NewLoxFunction(f.declaration, environment, f.isInitializer, f.globals)
 }
 
 func (f *LoxFunction) Arity() int { return len(f.declaration.params) }
 
 func (f *LoxFunction) Call(interpreter *Interpreter, arguments []interface{}) interface{} {
-	environment := NewEnvironment(f.closure)
+	environment := newLocalEnvironment(f.closure, len(f.declaration.params))
 	for i := 0; i < len(f.declaration.params); i++ {
 		environment.define(f.declaration.params[i].lexeme, arguments[i])
 	}
+	previousGlobals := interpreter.globals
+	interpreter.globals = f.globals
+	c := interpreter.executeBlock(f.declaration.body, environment)
+	interpreter.globals = previousGlobals
+
 	var returnValue interface{}
-	func() {
-		defer func() {
-			if r := recover(); r != nil {
-				if r, ok := r.(returnSignal); ok {
-					returnValue = r.value
-				} else {
-					panic(r)
-				}
-			}
-		}()
-		interpreter.executeBlock(f.declaration.body, environment)
-	}()
+	switch c {
+	case completionThrow:
+		panic(interpreter.thrown)
+	case completionReturn:
+		returnValue = interpreter.returnValue
+		interpreter.returnValue = nil
+	}
+	if f.isInitializer {
+		return f.closure.slots[0].value
+	}
 	return returnValue
 }
 
-func (f *LoxFunction) String() string { return "<function" + f.declaration.name.lexeme + ">" }
+func (f *LoxFunction) String() string {
+	if f.declaration.name == nil {
+		return "<fn>"
+	}
+	return "<fn " + f.declaration.name.lexeme + ">"
+}
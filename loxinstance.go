@@ -0,0 +1,29 @@
+package lox
+
+type LoxInstance struct {
+	class  *LoxClass
+	fields map[string]interface{}
+}
+
+func NewLoxInstance(class *LoxClass) *LoxInstance {
+	return &LoxInstance{
+		class:  class,
+		fields: make(map[string]interface{}),
+	}
+}
+
+func (i *LoxInstance) get(name *Token) interface{} {
+	if v, ok := i.fields[name.lexeme]; ok {
+		return v
+	}
+	if method := i.class.findMethod(name.lexeme); method != nil {
+		return method.bind(i)
+	}
+	panic(NewRuntimeError(name, "Undefined property '"+name.lexeme+"'."))
+}
+
+func (i *LoxInstance) set(name *Token, value interface{}) {
+	i.fields[name.lexeme] = value
+}
+
+func (i *LoxInstance) String() string { return i.class.name + " instance" }
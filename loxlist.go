@@ -0,0 +1,79 @@
+package lox
+
+import (
+	"math"
+	"strings"
+)
+
+type LoxList struct {
+	elements []interface{}
+}
+
+func NewLoxList(elements []interface{}) *LoxList {
+	return &LoxList{elements}
+}
+
+func (l *LoxList) getIndex(bracket *Token, index interface{}) interface{} {
+	return l.elements[l.checkIndex(bracket, index)]
+}
+
+func (l *LoxList) setIndex(bracket *Token, index interface{}, value interface{}) {
+	l.elements[l.checkIndex(bracket, index)] = value
+}
+
+func (l *LoxList) checkIndex(bracket *Token, index interface{}) int {
+	n, ok := index.(float64)
+	if !ok || n != math.Trunc(n) {
+		panic(NewRuntimeError(bracket, "List index must be an integer."))
+	}
+	if n < 0 || n >= float64(len(l.elements)) {
+		panic(NewRuntimeError(bracket, "List index out of range."))
+	}
+	return int(n)
+}
+
+func (l *LoxList) get(name *Token) interface{} {
+	switch name.lexeme {
+	case "length":
+		return &nativeMethod{name, 0, func(arguments []interface{}) interface{} {
+			return float64(len(l.elements))
+		}}
+	case "append":
+		return &nativeMethod{name, 1, func(arguments []interface{}) interface{} {
+			l.elements = append(l.elements, arguments[0])
+			return nil
+		}}
+	case "pop":
+		return &nativeMethod{name, 0, func(arguments []interface{}) interface{} {
+			if len(l.elements) == 0 {
+				panic(NewRuntimeError(name, "Can't pop from an empty list."))
+			}
+			last := l.elements[len(l.elements)-1]
+			l.elements = l.elements[:len(l.elements)-1]
+			return last
+		}}
+	}
+	panic(NewRuntimeError(name, "Undefined property '"+name.lexeme+"'."))
+}
+
+func (l *LoxList) String() string {
+	var b strings.Builder
+	b.WriteString("[")
+	for i, element := range l.elements {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(stringifyElement(element))
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+// stringifyElement is like stringify, but quotes strings so that they can be
+// told apart from other values inside a collection.
+func stringifyElement(object interface{}) string {
+	if s, ok := object.(string); ok {
+		return "\"" + s + "\""
+	}
+	return stringify(object)
+}
@@ -0,0 +1,113 @@
+package lox
+
+import (
+	"math"
+	"strings"
+)
+
+// LoxMap is a hash map that remembers the insertion order of its keys.
+//
+// Keys are compared the same way as the == operator does (see isEqual). NaN
+// can't be a key, since it isn't equal to itself.
+type LoxMap struct {
+	// order lists the entries in insertion order.
+	order   []*mapEntry
+	entries map[interface{}]*mapEntry
+}
+
+type mapEntry struct {
+	key   interface{}
+	value interface{}
+	index int
+}
+
+func NewLoxMap() *LoxMap {
+	return &LoxMap{entries: make(map[interface{}]*mapEntry)}
+}
+
+func (m *LoxMap) getIndex(bracket *Token, key interface{}) interface{} {
+	if entry, ok := m.entries[key]; ok {
+		return entry.value
+	}
+	panic(NewRuntimeError(bracket, "Undefined key "+stringifyElement(key)+"."))
+}
+
+func (m *LoxMap) setIndex(bracket *Token, key interface{}, value interface{}) {
+	if entry, ok := m.entries[key]; ok {
+		entry.value = value
+		return
+	}
+	if n, ok := key.(float64); ok && math.IsNaN(n) {
+		panic(NewRuntimeError(bracket, "Map key can't be NaN."))
+	}
+	entry := &mapEntry{key, value, len(m.order)}
+	m.entries[key] = entry
+	m.order = append(m.order, entry)
+}
+
+func (m *LoxMap) has(key interface{}) bool {
+	_, ok := m.entries[key]
+	return ok
+}
+
+func (m *LoxMap) delete(key interface{}) bool {
+	entry, ok := m.entries[key]
+	if !ok {
+		return false
+	}
+	delete(m.entries, key)
+	m.order = append(m.order[:entry.index], m.order[entry.index+1:]...)
+	for _, e := range m.order[entry.index:] {
+		e.index--
+	}
+	return true
+}
+
+func (m *LoxMap) get(name *Token) interface{} {
+	switch name.lexeme {
+	case "length":
+		return &nativeMethod{name, 0, func(arguments []interface{}) interface{} {
+			return float64(len(m.order))
+		}}
+	case "keys":
+		return &nativeMethod{name, 0, func(arguments []interface{}) interface{} {
+			keys := make([]interface{}, len(m.order))
+			for k, entry := range m.order {
+				keys[k] = entry.key
+			}
+			return NewLoxList(keys)
+		}}
+	case "values":
+		return &nativeMethod{name, 0, func(arguments []interface{}) interface{} {
+			values := make([]interface{}, len(m.order))
+			for k, entry := range m.order {
+				values[k] = entry.value
+			}
+			return NewLoxList(values)
+		}}
+	case "has":
+		return &nativeMethod{name, 1, func(arguments []interface{}) interface{} {
+			return m.has(arguments[0])
+		}}
+	case "delete":
+		return &nativeMethod{name, 1, func(arguments []interface{}) interface{} {
+			return m.delete(arguments[0])
+		}}
+	}
+	panic(NewRuntimeError(name, "Undefined property '"+name.lexeme+"'."))
+}
+
+func (m *LoxMap) String() string {
+	var b strings.Builder
+	b.WriteString("{")
+	for i, entry := range m.order {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(stringifyElement(entry.key))
+		b.WriteString(": ")
+		b.WriteString(stringifyElement(entry.value))
+	}
+	b.WriteString("}")
+	return b.String()
+}
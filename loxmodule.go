@@ -0,0 +1,128 @@
+package lox
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LoxModule is the value bound by an import statement. Its properties are the
+// top-level definitions of the imported file.
+type LoxModule struct {
+	name        string
+	path        string
+	environment *Environment
+}
+
+func (m *LoxModule) get(name *Token) interface{} {
+	if v, ok := m.environment.values[name.lexeme]; ok {
+		return v
+	}
+	panic(NewRuntimeError(name, "Module '"+m.name+"' has no top-level '"+name.lexeme+"'."))
+}
+
+func (m *LoxModule) String() string { return "<module " + m.name + ">" }
+
+// SetScriptPath sets the path of the script being run. Relative imports are
+// resolved from its directory when the importing file name is not known.
+func (i *Interpreter) SetScriptPath(path string) {
+	i.scriptDir = filepath.Dir(path)
+	if abs, err := filepath.Abs(path); err == nil {
+		// The script itself can't be imported while it runs.
+		i.importing = []string{abs}
+	}
+}
+
+// SetSearchPath sets the directories where imported modules are looked up
+// when they are not found relative to the importing file.
+func (i *Interpreter) SetSearchPath(dirs []string) {
+	i.searchPath = dirs
+}
+
+// importModule loads the module at the given path, executing it the first
+// time it is imported.
+func (i *Interpreter) importModule(pathToken *Token) *LoxModule {
+	path := i.findModule(pathToken)
+
+	if module, ok := i.modules[path]; ok {
+		return module
+	}
+
+	for k, p := range i.importing {
+		if p == path {
+			var cycle []string
+			for _, p := range append(i.importing[k:], path) {
+				cycle = append(cycle, filepath.Base(p))
+			}
+			panic(NewRuntimeError(pathToken, "Import cycle: "+strings.Join(cycle, " -> ")+"."))
+		}
+	}
+	i.importing = append(i.importing, path)
+	defer func() { i.importing = i.importing[:len(i.importing)-1] }()
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		panic(NewRuntimeError(pathToken, err.Error()))
+	}
+
+	statements, diagnostics := i.compile(string(b), path)
+	var function *vmFunction
+	if !diagnostics.HasErrors() && i.backend == BytecodeVM {
+		function, diagnostics = compileScript(statements, false)
+	}
+	if diagnostics.HasErrors() {
+		panic(NewRuntimeError(pathToken, "Could not load module '"+pathToken.literal.(string)+"':\n"+diagnostics.Error()))
+	}
+
+	name := filepath.Base(path)
+	module := &LoxModule{
+		name:        strings.TrimSuffix(name, filepath.Ext(name)),
+		path:        path,
+		environment: NewEnvironment(i.builtins),
+	}
+
+	if function != nil {
+		i.vm.callScript(function, module.environment)
+	} else {
+		previousGlobals, previous := i.globals, i.environment
+		i.globals, i.environment = module.environment, module.environment
+		defer func() { i.globals, i.environment = previousGlobals, previous }()
+
+		i.executeTopLevel(statements)
+	}
+
+	i.modules[path] = module
+	return module
+}
+
+// findModule returns the absolute path of the file to import, looking first
+// relative to the importing file and then in the search path.
+func (i *Interpreter) findModule(pathToken *Token) string {
+	path := pathToken.literal.(string)
+
+	dir := i.scriptDir
+	if filename := pathToken.Filename(); filename != "" {
+		dir = filepath.Dir(filename)
+	}
+
+	var candidates []string
+	if filepath.IsAbs(path) {
+		candidates = []string{path}
+	} else {
+		candidates = append(candidates, filepath.Join(dir, path))
+		for _, dir := range i.searchPath {
+			candidates = append(candidates, filepath.Join(dir, path))
+		}
+	}
+
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			if abs, err := filepath.Abs(candidate); err == nil {
+				return abs
+			}
+			return candidate
+		}
+	}
+	panic(NewRuntimeError(pathToken, "Module '"+path+"' not found."))
+}
@@ -0,0 +1,404 @@
+// Package loxtest runs tests written in Lox.
+//
+// Test functions are top-level functions whose name starts with "test_",
+// which check the code with assert statements:
+//
+//	fun test_add() {
+//	  assert 1 + 2 == 3, "should add";
+//	}
+//
+// Golden tests are scripts annotated with comments describing what they
+// should print, in the format of the Crafting Interpreters test suite:
+//
+//	print 1 + 2; // expect: 3
+//	print -"a";  // expect runtime error: Operand must be a number.
+//	var a = ;    // Error at ';': Expect expression.
+//	// [line 7] Error at end: Expect '}' after block.
+package loxtest
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dessaya/lox"
+)
+
+var (
+	expectedOutputPattern       = regexp.MustCompile(`// expect: ?(.*)`)
+	expectedErrorPattern        = regexp.MustCompile(`// (Error.*)`)
+	errorLinePattern            = regexp.MustCompile(`// \[line (\d+)\] (Error.*)`)
+	expectedRuntimeErrorPattern = regexp.MustCompile(`// expect runtime error: (.+)`)
+)
+
+// Expectations is what a golden test should print, as described by its
+// annotations.
+type Expectations struct {
+	Output []ExpectedOutput
+	// CompileErrors are formatted like lox.Diagnostic.Error, e.g.
+	// "[line 3] Error at 'a': Expect expression.".
+	CompileErrors []string
+	// RuntimeError is the message of the runtime error that aborts the
+	// script, or "" if none is expected.
+	RuntimeError     string
+	RuntimeErrorLine int
+}
+
+// ExpectedOutput is a line that the script should print.
+type ExpectedOutput struct {
+	Text string
+	// Line is the line of the annotation.
+	Line int
+}
+
+// ParseExpectations reads the annotations in the source code.
+func ParseExpectations(source string) Expectations {
+	var e Expectations
+	scanner := bufio.NewScanner(strings.NewReader(source))
+	scanner.Buffer(nil, len(source)+1)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if m := expectedOutputPattern.FindStringSubmatch(text); m != nil {
+			e.Output = append(e.Output, ExpectedOutput{m[1], line})
+		} else if m := expectedErrorPattern.FindStringSubmatch(text); m != nil {
+			e.CompileErrors = append(e.CompileErrors, fmt.Sprintf("[line %d] %s", line, m[1]))
+		} else if m := errorLinePattern.FindStringSubmatch(text); m != nil {
+			e.CompileErrors = append(e.CompileErrors, fmt.Sprintf("[line %s] %s", m[1], m[2]))
+		} else if m := expectedRuntimeErrorPattern.FindStringSubmatch(text); m != nil {
+			e.RuntimeError, e.RuntimeErrorLine = m[1], line
+		}
+	}
+	return e
+}
+
+// empty reports whether the script has no annotations.
+func (e Expectations) empty() bool {
+	return len(e.Output) == 0 && len(e.CompileErrors) == 0 && e.RuntimeError == ""
+}
+
+// ExitCode returns the exit status of jlox when running the script: 65 if
+// there are compile errors, 70 if there is a runtime error, and 0 otherwise.
+func (e Expectations) ExitCode() int {
+	switch {
+	case len(e.CompileErrors) > 0:
+		return 65
+	case e.RuntimeError != "":
+		return 70
+	}
+	return 0
+}
+
+// Result is the outcome of a test.
+type Result struct {
+	// Name identifies the test: the path of a golden test, or the path and
+	// the function name of a test function, e.g. "list.lox::test_append".
+	Name string
+	// Failures describe how the test failed, or are empty if it passed.
+	Failures []string
+	// Error is set if the test could not run to completion because of an
+	// error other than a failed assertion or expectation.
+	Error    bool
+	Duration time.Duration
+}
+
+// Passed reports whether the test passed.
+func (r *Result) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+func (r *Result) fail(format string, args ...interface{}) {
+	r.Failures = append(r.Failures, fmt.Sprintf(format, args...))
+}
+
+// Runner runs tests, each one with its own Interpreter.
+type Runner struct {
+	// Options configure the interpreters. The output and input of the
+	// scripts are always redirected by the runner.
+	Options []lox.Option
+	// SearchPath is passed to Interpreter.SetSearchPath.
+	SearchPath []string
+	// Parallel is the number of tests that run at the same time. If it is
+	// not positive, runtime.GOMAXPROCS(0) is used.
+	Parallel int
+	// Timeout aborts each test with a runtime error after the given
+	// duration, unless it is 0.
+	Timeout time.Duration
+}
+
+// newInterpreter returns an interpreter that writes the output of the
+// script to stdout, and reads from an empty input.
+func (r *Runner) newInterpreter(stdout *strings.Builder) *lox.Interpreter {
+	options := append(append([]lox.Option{}, r.Options...),
+		lox.WithStdout(stdout),
+		lox.WithStderr(ioutil.Discard),
+		lox.WithStdin(strings.NewReader("")),
+	)
+	i := lox.NewInterpreter(options...)
+	if r.SearchPath != nil {
+		i.SetSearchPath(r.SearchPath)
+	}
+	return i
+}
+
+func (r *Runner) context() (context.Context, context.CancelFunc) {
+	if r.Timeout == 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), r.Timeout)
+}
+
+// runAll runs the tests in parallel, and returns their results in the same
+// order.
+func (r *Runner) runAll(tests []func() *Result) []*Result {
+	results := make([]*Result, len(tests))
+	parallel := r.Parallel
+	if parallel <= 0 {
+		parallel = runtime.GOMAXPROCS(0)
+	}
+
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range indices {
+				results[k] = tests[k]()
+			}
+		}()
+	}
+	for k := range tests {
+		indices <- k
+	}
+	close(indices)
+	wg.Wait()
+	return results
+}
+
+// Run runs the test functions of the files that define any, as RunTests
+// does, and the other files as golden tests. Files with test functions are
+// also run as golden tests if they have any annotations.
+func (r *Runner) Run(paths []string) []*Result {
+	var tests []func() *Result
+	for _, path := range paths {
+		if b, err := ioutil.ReadFile(path); err == nil {
+			if names, diagnostics := TestFunctions(path, string(b)); !diagnostics.HasErrors() && len(names) > 0 {
+				tests = append(tests, r.testFunctions(path, string(b), names)...)
+				if ParseExpectations(string(b)).empty() {
+					continue
+				}
+			}
+		}
+		tests = append(tests, r.golden(path))
+	}
+	return r.runAll(tests)
+}
+
+// RunGolden runs the golden tests in parallel, and returns their results in
+// the same order.
+func (r *Runner) RunGolden(paths []string) []*Result {
+	tests := make([]func() *Result, len(paths))
+	for k, path := range paths {
+		tests[k] = r.golden(path)
+	}
+	return r.runAll(tests)
+}
+
+func (r *Runner) golden(path string) func() *Result {
+	return func() *Result { return r.RunGoldenFile(path) }
+}
+
+// RunGoldenFile runs a golden test, and compares its output with the
+// expectations.
+func (r *Runner) RunGoldenFile(path string) (result *Result) {
+	result = &Result{Name: path}
+	start := time.Now()
+	defer func() { result.Duration = time.Since(start) }()
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		result.fail("%s", err)
+		return result
+	}
+	source := string(b)
+	expected := ParseExpectations(source)
+	if len(expected.CompileErrors) > 0 && expected.RuntimeError != "" {
+		result.fail("Cannot expect both compile and runtime errors.")
+		return result
+	}
+
+	var stdout strings.Builder
+	i := r.newInterpreter(&stdout)
+	i.SetScriptPath(path)
+	ctx, cancel := r.context()
+	defer cancel()
+	err = eval(ctx, i, source, path)
+
+	exitCode := 0
+	switch err := err.(type) {
+	case nil:
+	case lox.Diagnostics:
+		exitCode = 65
+		checkCompileErrors(result, expected, err)
+	case lox.RuntimeError:
+		exitCode = 70
+		checkRuntimeError(result, expected, err)
+	default:
+		exitCode = 70
+		result.Error = true
+		result.fail("Interpreter crashed: %s", err)
+	}
+	if exitCode == 0 {
+		for _, e := range expected.CompileErrors {
+			result.fail("Missing expected error: %s", e)
+		}
+		if expected.RuntimeError != "" {
+			result.fail("Expected runtime error '%s' and got none.", expected.RuntimeError)
+		}
+	}
+	checkOutput(result, expected.Output, stdout.String())
+	if exitCode != expected.ExitCode() {
+		result.fail("Expected return code %d and got %d.", expected.ExitCode(), exitCode)
+	}
+	return result
+}
+
+// eval runs the script, turning a panic of the interpreter into an error so
+// that it doesn't bring down the other tests.
+func eval(ctx context.Context, i *lox.Interpreter, source string, filename string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	_, err = i.EvalContext(ctx, source, filename)
+	return err
+}
+
+func checkCompileErrors(result *Result, expected Expectations, diagnostics lox.Diagnostics) {
+	var actual []string
+	for _, d := range diagnostics {
+		if d.Severity == lox.SeverityError {
+			actual = append(actual, d.Error())
+		}
+	}
+
+	// The order of the errors doesn't matter.
+	missing := make(map[string]int)
+	for _, e := range expected.CompileErrors {
+		missing[e]++
+	}
+	for _, a := range actual {
+		if missing[a] > 0 {
+			missing[a]--
+		} else {
+			result.fail("Unexpected error: %s", a)
+		}
+	}
+	var notFound []string
+	for e, n := range missing {
+		for ; n > 0; n-- {
+			notFound = append(notFound, e)
+		}
+	}
+	sort.Strings(notFound)
+	for _, e := range notFound {
+		result.fail("Missing expected error: %s", e)
+	}
+}
+
+func checkRuntimeError(result *Result, expected Expectations, err lox.RuntimeError) {
+	if expected.RuntimeError == "" {
+		result.fail("Unexpected runtime error: %s", err.Error())
+		return
+	}
+	if err.Error() != expected.RuntimeError {
+		result.fail("Expected runtime error '%s' and got '%s'.", expected.RuntimeError, err.Error())
+	}
+	if err.Token != nil && err.Token.Position().Line != expected.RuntimeErrorLine {
+		result.fail("Expected runtime error on line %d but was on line %d.",
+			expected.RuntimeErrorLine, err.Token.Position().Line)
+	}
+}
+
+func checkOutput(result *Result, expected []ExpectedOutput, stdout string) {
+	lines := strings.Split(stdout, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for k, line := range lines {
+		if k >= len(expected) {
+			result.fail("Got output '%s' when none was expected.", line)
+			continue
+		}
+		if line != expected[k].Text {
+			result.fail("Expected output '%s' on line %d and got '%s'.", expected[k].Text, expected[k].Line, line)
+		}
+	}
+	for _, e := range expected[min(len(lines), len(expected)):] {
+		result.fail("Missing expected output '%s' on line %d.", e.Text, e.Line)
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Files returns the .lox files under each of the paths, which may be files
+// or directories, sorted by name. As with go test, directories named testdata
+// are skipped, unless they are one of the paths.
+func Files(paths []string) ([]string, error) {
+	var files []string
+	for _, root := range paths {
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() && info.Name() == "testdata" && path != root {
+				return filepath.SkipDir
+			}
+			if !info.IsDir() && filepath.Ext(path) == ".lox" {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// Summary returns e.g. "3 passed, 1 failed.", or "3 passed, 1 failed, 1
+// error." if there are results with Error set, which are not counted as
+// failed.
+func Summary(results []*Result) string {
+	passed, errors := 0, 0
+	for _, r := range results {
+		if r.Passed() {
+			passed++
+		} else if r.Error {
+			errors++
+		}
+	}
+	s := fmt.Sprintf("%d passed, %d failed", passed, len(results)-passed-errors)
+	switch errors {
+	case 0:
+		return s + "."
+	case 1:
+		return s + ", 1 error."
+	}
+	return fmt.Sprintf("%s, %d errors.", s, errors)
+}
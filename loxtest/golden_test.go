@@ -0,0 +1,72 @@
+package loxtest
+
+import (
+	"testing"
+
+	"github.com/dessaya/lox"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExpectations(t *testing.T) {
+	e := ParseExpectations(`print 1; // expect: 1
+print ""; // expect:
+var a = ; // Error at ';': Expect expression.
+// [line 7] Error at end: Expect '}' after block.
+nil(); // expect runtime error: Can only call functions and classes.
+`)
+	require.Equal(t, []ExpectedOutput{{"1", 1}, {"", 2}}, e.Output)
+	require.Equal(t, []string{
+		"[line 3] Error at ';': Expect expression.",
+		"[line 7] Error at end: Expect '}' after block.",
+	}, e.CompileErrors)
+	require.Equal(t, "Can only call functions and classes.", e.RuntimeError)
+	require.Equal(t, 5, e.RuntimeErrorLine)
+	require.Equal(t, 65, e.ExitCode())
+}
+
+func TestRunGolden(t *testing.T) {
+	files, err := Files([]string{"testdata/pass", "testdata/fail/mismatch.lox"})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"testdata/pass/compile_error.lox",
+		"testdata/pass/output.lox",
+		"testdata/pass/runtime_error.lox",
+		"testdata/fail/mismatch.lox",
+	}, files)
+
+	for _, backend := range []lox.Backend{lox.TreeWalker, lox.BytecodeVM} {
+		r := &Runner{Options: []lox.Option{lox.WithBackend(backend)}}
+		results := r.RunGolden(files)
+		require.Len(t, results, 4)
+		for _, result := range results[:3] {
+			require.Empty(t, result.Failures, result.Name)
+		}
+		require.Equal(t, "testdata/fail/mismatch.lox", results[3].Name)
+		require.Equal(t, []string{
+			"Expected runtime error 'Operand must be a number.' and got 'Operands must be two numbers or two strings.'.",
+			"Expected output '2' on line 1 and got '1'.",
+			"Expected output '4' on line 3 and got '3'.",
+		}, results[3].Failures)
+		require.Equal(t, "3 passed, 1 failed.", Summary(results))
+	}
+}
+
+func TestFilesSkipsTestdata(t *testing.T) {
+	files, err := Files([]string{"."})
+	require.NoError(t, err)
+	require.Empty(t, files)
+
+	files, err = Files([]string{"testdata/unit"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"testdata/unit/annotated.lox", "testdata/unit/list.lox"}, files)
+}
+
+func TestRunGoldenExitCode(t *testing.T) {
+	r := &Runner{}
+	result := r.RunGoldenFile("testdata/fail/missing_error.lox")
+	require.Equal(t, []string{
+		"Missing expected error: [line 1] Error at 'a': Expect expression.",
+		"Missing expected output 'never' on line 2.",
+		"Expected return code 65 and got 0.",
+	}, result.Failures)
+}
@@ -0,0 +1,97 @@
+package loxtest
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/dessaya/lox"
+)
+
+// testPrefix starts the names of the test functions.
+const testPrefix = "test_"
+
+// TestFunctions returns the names of the top-level functions of the source
+// code that are tests, i.e. whose name starts with "test_", in the order
+// they are declared.
+func TestFunctions(filename string, source string) ([]string, lox.Diagnostics) {
+	analysis := lox.Analyze(filename, source)
+	if analysis.Diagnostics.HasErrors() {
+		return nil, analysis.Diagnostics
+	}
+	var names []string
+	for _, symbol := range analysis.Symbols {
+		if symbol.Kind == lox.FunctionSymbol && symbol.Global && strings.HasPrefix(symbol.Name, testPrefix) {
+			names = append(names, symbol.Name)
+		}
+	}
+	return names, nil
+}
+
+// RunTests runs the test functions of the files in parallel, and returns
+// their results in order. Each test has an Interpreter of its own, which runs
+// the whole file and then calls the test function with no arguments. The test
+// fails if the call raises a runtime error, such as a failed assertion.
+func (r *Runner) RunTests(paths []string) []*Result {
+	var tests []func() *Result
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			result := &Result{Name: path, Error: true}
+			result.fail("%s", err)
+			tests = append(tests, func() *Result { return result })
+			continue
+		}
+		names, diagnostics := TestFunctions(path, string(b))
+		if diagnostics.HasErrors() {
+			result := &Result{Name: path, Error: true}
+			result.fail("%s", strings.TrimSuffix(diagnostics.Render(), "\n"))
+			tests = append(tests, func() *Result { return result })
+			continue
+		}
+		tests = append(tests, r.testFunctions(path, string(b), names)...)
+	}
+	return r.runAll(tests)
+}
+
+func (r *Runner) testFunctions(path string, source string, names []string) []func() *Result {
+	tests := make([]func() *Result, len(names))
+	for k, name := range names {
+		name := name
+		tests[k] = func() *Result { return r.runTestFunction(path, source, name) }
+	}
+	return tests
+}
+
+func (r *Runner) runTestFunction(path string, source string, name string) (result *Result) {
+	result = &Result{Name: path + "::" + name}
+	start := time.Now()
+	defer func() { result.Duration = time.Since(start) }()
+
+	var stdout strings.Builder
+	i := r.newInterpreter(&stdout)
+	i.SetScriptPath(path)
+	ctx, cancel := r.context()
+	defer cancel()
+	err := eval(ctx, i, source, path)
+	called := false
+	if err == nil {
+		err, called = eval(ctx, i, name+"();", ""), true
+	}
+
+	switch err := err.(type) {
+	case nil:
+	case lox.RuntimeError:
+		result.Error = !errors.Is(err, lox.ErrAssertionFailed)
+		// Leave out the call made by the runner.
+		if n := len(err.StackTrace); called && n > 1 {
+			err.StackTrace = err.StackTrace[:n-1]
+		}
+		result.fail("%s", strings.TrimSuffix(err.Render(), "\n"))
+	default:
+		result.Error = true
+		result.fail("%s", err)
+	}
+	return result
+}
@@ -0,0 +1,64 @@
+package loxtest
+
+import (
+	"testing"
+
+	"github.com/dessaya/lox"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTestFunctions(t *testing.T) {
+	names, diagnostics := TestFunctions("", `fun test_a() {}
+class test_b { test_c() {} }
+fun f() { fun test_d() {} }
+var test_e = fun () {};
+fun test_f() {}
+`)
+	require.Nil(t, diagnostics)
+	require.Equal(t, []string{"test_a", "test_f"}, names)
+
+	_, diagnostics = TestFunctions("", "fun test_a() {")
+	require.True(t, diagnostics.HasErrors())
+}
+
+func TestRunTests(t *testing.T) {
+	for _, backend := range []lox.Backend{lox.TreeWalker, lox.BytecodeVM} {
+		r := &Runner{Options: []lox.Option{lox.WithBackend(backend)}}
+		results := r.RunTests([]string{"testdata/unit/list.lox"})
+		require.Len(t, results, 4)
+
+		require.Equal(t, "testdata/unit/list.lox::test_sum", results[0].Name)
+		require.True(t, results[0].Passed())
+		require.True(t, results[1].Passed())
+
+		require.Equal(t, []string{"testdata/unit/list.lox:19:3: runtime error: Assertion failed: list.length() == 4: got the previous list\n" +
+			" 19 |   assert list.length() == 4, \"got \" + \"the previous list\";\n" +
+			"    |   ^~~~~~"}, results[2].Failures)
+		require.False(t, results[2].Error)
+
+		require.True(t, results[3].Error)
+		require.Len(t, results[3].Failures, 1)
+		require.Contains(t, results[3].Failures[0], "Only instances have properties.")
+		require.Contains(t, results[3].Failures[0], "Traceback (most recent call first):\n"+
+			"  testdata/unit/list.lox:5:26 in sum()\n"+
+			"  testdata/unit/list.lox:23:10 in test_error()")
+		require.NotContains(t, results[3].Failures[0], "in script")
+
+		require.Equal(t, "2 passed, 1 failed, 1 error.", Summary(results))
+	}
+}
+
+func TestRun(t *testing.T) {
+	results := (&Runner{}).Run([]string{"testdata/pass/output.lox", "testdata/unit/list.lox"})
+	require.Len(t, results, 5)
+	require.Equal(t, "testdata/pass/output.lox", results[0].Name)
+	require.Equal(t, "testdata/unit/list.lox::test_sum", results[1].Name)
+
+	// The annotations of files with test functions are checked too.
+	results = (&Runner{}).Run([]string{"testdata/unit/annotated.lox"})
+	require.Len(t, results, 2)
+	require.Equal(t, "testdata/unit/annotated.lox::test_add", results[0].Name)
+	require.True(t, results[0].Passed())
+	require.Equal(t, "testdata/unit/annotated.lox", results[1].Name)
+	require.Equal(t, []string{"Expected output '3' on line 2 and got '2'."}, results[1].Failures)
+}
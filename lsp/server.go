@@ -0,0 +1,354 @@
+// Package lsp implements a language server for Lox, speaking the Language
+// Server Protocol over a pair of streams such as stdin and stdout.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dessaya/lox"
+	"github.com/dessaya/lox/internal/framing"
+)
+
+// Serve reads requests from in and writes the responses to out, until the
+// client sends the exit notification. It returns an error if the input ends
+// before that, if a message can't be written, or if the client exits without
+// shutting down the server.
+func Serve(in io.Reader, out io.Writer) error {
+	s := &server{out: out, documents: make(map[string]*document)}
+	r := bufio.NewReader(in)
+	for {
+		b, err := framing.ReadMessage(r)
+		if err != nil {
+			if err == io.EOF {
+				return errors.New("connection closed without exit notification")
+			}
+			return err
+		}
+		var msg message
+		if err := json.Unmarshal(b, &msg); err != nil {
+			if err := s.reply(nil, nil, &responseError{parseError, err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit notification before shutdown")
+			}
+			return nil
+		}
+		if err := s.handle(&msg); err != nil {
+			return err
+		}
+	}
+}
+
+// document is an open text document, along with its analysis.
+type document struct {
+	text     string
+	analysis *lox.Analysis
+}
+
+type server struct {
+	out       io.Writer
+	documents map[string]*document
+	shutdown  bool
+}
+
+// handlers are the functions that handle each request, given its decoded
+// parameters. Their results are sent back as the responses.
+var handlers = map[string]func(s *server, params json.RawMessage) (interface{}, error){
+	"initialize":                  (*server).initialize,
+	"shutdown":                    (*server).shutdownRequest,
+	"textDocument/definition":     (*server).definition,
+	"textDocument/references":     (*server).references,
+	"textDocument/hover":          (*server).hover,
+	"textDocument/documentSymbol": (*server).documentSymbol,
+	"textDocument/completion":     (*server).completion,
+}
+
+// notificationHandlers are the functions that handle each notification.
+var notificationHandlers = map[string]func(s *server, params json.RawMessage) error{
+	"textDocument/didOpen":   (*server).didOpen,
+	"textDocument/didChange": (*server).didChange,
+	"textDocument/didClose":  (*server).didClose,
+}
+
+func (s *server) handle(msg *message) error {
+	if msg.ID == nil {
+		// Unknown notifications, such as "initialized", are ignored.
+		handler, ok := notificationHandlers[msg.Method]
+		if !ok {
+			return nil
+		}
+		err := handler(s, msg.Params)
+		if _, ok := err.(writeError); ok || err == nil {
+			return err
+		}
+		// Notifications have no response, so the error is only logged,
+		// instead of shutting down the server because of a bad message.
+		return s.notify("window/logMessage", &logMessageParams{
+			Type:    errorMessageType,
+			Message: msg.Method + ": " + err.Error(),
+		})
+	}
+
+	if s.shutdown {
+		return s.reply(msg.ID, nil, &responseError{invalidRequest, "Server is shut down."})
+	}
+	handler, ok := handlers[msg.Method]
+	if !ok {
+		return s.reply(msg.ID, nil, &responseError{methodNotFound, "Method not found: " + msg.Method})
+	}
+	result, err := handler(s, msg.Params)
+	if err != nil {
+		return s.reply(msg.ID, nil, &responseError{invalidParams, err.Error()})
+	}
+	return s.reply(msg.ID, result, nil)
+}
+
+// writeError is an error sending a message to the client, which ends the
+// session.
+type writeError struct{ error }
+
+func (s *server) write(msg interface{}) error {
+	if err := framing.WriteMessage(s.out, msg); err != nil {
+		return writeError{err}
+	}
+	return nil
+}
+
+func (s *server) reply(id *json.RawMessage, result interface{}, err *responseError) error {
+	return s.write(&response{JSONRPC: "2.0", ID: id, Result: result, Error: err})
+}
+
+func (s *server) notify(method string, params interface{}) error {
+	return s.write(&notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *server) initialize(params json.RawMessage) (interface{}, error) {
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			// Documents are synchronized by sending their full text.
+			"textDocumentSync":       1,
+			"definitionProvider":     true,
+			"referencesProvider":     true,
+			"hoverProvider":          true,
+			"documentSymbolProvider": true,
+			"completionProvider":     map[string]interface{}{},
+		},
+		"serverInfo": map[string]interface{}{"name": "lox"},
+	}, nil
+}
+
+func (s *server) shutdownRequest(params json.RawMessage) (interface{}, error) {
+	s.shutdown = true
+	return nil, nil
+}
+
+func (s *server) didOpen(params json.RawMessage) error {
+	var p didOpenParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return err
+	}
+	return s.update(p.TextDocument.URI, p.TextDocument.Text)
+}
+
+func (s *server) didChange(params json.RawMessage) error {
+	var p didChangeParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return err
+	}
+	if len(p.ContentChanges) == 0 {
+		return nil
+	}
+	return s.update(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+}
+
+func (s *server) didClose(params json.RawMessage) error {
+	var p didCloseParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return err
+	}
+	delete(s.documents, p.TextDocument.URI)
+	return s.notify("textDocument/publishDiagnostics", &publishDiagnosticsParams{
+		URI:         p.TextDocument.URI,
+		Diagnostics: []diagnostic{},
+	})
+}
+
+// update analyzes the new text of the document and publishes its
+// diagnostics.
+func (s *server) update(uri string, text string) error {
+	doc := &document{text: text, analysis: lox.Analyze(uri, text)}
+	s.documents[uri] = doc
+
+	diagnostics := []diagnostic{}
+	for _, d := range doc.analysis.Diagnostics {
+		severity := errorSeverity
+		if d.Severity == lox.SeverityWarning {
+			severity = warningSeverity
+		}
+		diagnostics = append(diagnostics, diagnostic{
+			Range:    rangeOf(text, d.Offset, d.End),
+			Severity: severity,
+			Source:   "lox",
+			Message:  d.Message,
+		})
+	}
+	return s.notify("textDocument/publishDiagnostics", &publishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: diagnostics,
+	})
+}
+
+// symbolAt returns the document and the symbol at the position given in the
+// parameters. The symbol is nil if there is none.
+func (s *server) symbolAt(p *textDocumentPositionParams) (*document, *lox.Symbol, error) {
+	doc, ok := s.documents[p.TextDocument.URI]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown document: %s", p.TextDocument.URI)
+	}
+	return doc, doc.analysis.SymbolAt(offsetOf(doc.text, p.Position)), nil
+}
+
+func (s *server) definition(params json.RawMessage) (interface{}, error) {
+	var p textDocumentPositionParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	doc, symbol, err := s.symbolAt(&p)
+	if err != nil || symbol == nil {
+		return nil, err
+	}
+	return &location{URI: p.TextDocument.URI, Range: tokenRange(doc, symbol.Token)}, nil
+}
+
+func (s *server) references(params json.RawMessage) (interface{}, error) {
+	var p referenceParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	doc, symbol, err := s.symbolAt(&p.textDocumentPositionParams)
+	if err != nil || symbol == nil {
+		return nil, err
+	}
+	locations := []location{}
+	if p.Context.IncludeDeclaration {
+		locations = append(locations, location{URI: p.TextDocument.URI, Range: tokenRange(doc, symbol.Token)})
+	}
+	for _, token := range doc.analysis.ReferencesTo(symbol) {
+		locations = append(locations, location{URI: p.TextDocument.URI, Range: tokenRange(doc, token)})
+	}
+	return locations, nil
+}
+
+func (s *server) hover(params json.RawMessage) (interface{}, error) {
+	var p textDocumentPositionParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	doc, symbol, err := s.symbolAt(&p)
+	if err != nil || symbol == nil {
+		return nil, err
+	}
+	offset := offsetOf(doc.text, p.Position)
+	var token *lox.Token
+	for _, reference := range doc.analysis.References {
+		if reference.Token.Offset() <= offset && offset <= reference.Token.End() {
+			token = reference.Token
+		}
+	}
+	if token == nil {
+		token = symbol.Token
+	}
+	return &hover{
+		Contents: markupContent{Kind: "markdown", Value: "```lox\n" + signature(symbol) + "\n```"},
+		Range:    tokenRange(doc, token),
+	}, nil
+}
+
+func (s *server) documentSymbol(params json.RawMessage) (interface{}, error) {
+	var p documentSymbolParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	doc, ok := s.documents[p.TextDocument.URI]
+	if !ok {
+		return nil, fmt.Errorf("unknown document: %s", p.TextDocument.URI)
+	}
+	symbols := []documentSymbol{}
+	for _, symbol := range doc.analysis.Symbols {
+		if !symbol.Global {
+			continue
+		}
+		kind := variableSymbolKind
+		switch symbol.Kind {
+		case lox.FunctionSymbol:
+			kind = functionSymbolKind
+		case lox.ClassSymbol:
+			kind = classSymbolKind
+		case lox.ImportSymbol:
+			kind = moduleSymbolKind
+		}
+		r := tokenRange(doc, symbol.Token)
+		symbols = append(symbols, documentSymbol{
+			Name:           symbol.Name,
+			Detail:         signature(symbol),
+			Kind:           kind,
+			Range:          r,
+			SelectionRange: r,
+		})
+	}
+	return symbols, nil
+}
+
+func (s *server) completion(params json.RawMessage) (interface{}, error) {
+	var p textDocumentPositionParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	doc, ok := s.documents[p.TextDocument.URI]
+	if !ok {
+		return nil, fmt.Errorf("unknown document: %s", p.TextDocument.URI)
+	}
+	items := []completionItem{}
+	for _, symbol := range doc.analysis.InScope(offsetOf(doc.text, p.Position)) {
+		kind := variableCompletionKind
+		switch symbol.Kind {
+		case lox.FunctionSymbol:
+			kind = functionCompletionKind
+		case lox.ClassSymbol:
+			kind = classCompletionKind
+		case lox.ImportSymbol:
+			kind = moduleCompletionKind
+		}
+		items = append(items, completionItem{Label: symbol.Name, Kind: kind, Detail: signature(symbol)})
+	}
+	return items, nil
+}
+
+func tokenRange(doc *document, token *lox.Token) textRange {
+	return rangeOf(doc.text, token.Offset(), token.End())
+}
+
+// signature returns the declaration of the symbol as it would be written in
+// the code, e.g. "fun add(a, b)".
+func signature(symbol *lox.Symbol) string {
+	switch symbol.Kind {
+	case lox.FunctionSymbol:
+		return "fun " + symbol.Name + "(" + strings.Join(symbol.Params, ", ") + ")"
+	case lox.ClassSymbol:
+		return "class " + symbol.Name + "(" + strings.Join(symbol.Params, ", ") + ")"
+	case lox.ParameterSymbol:
+		return "(parameter) " + symbol.Name
+	case lox.ImportSymbol:
+		return "(import) " + symbol.Name
+	}
+	return "var " + symbol.Name
+}
@@ -0,0 +1,156 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/dessaya/lox/internal/framing"
+	"github.com/stretchr/testify/require"
+)
+
+// session runs the server on the given messages, followed by shutdown and
+// exit, and returns the messages it sent back, except the last response.
+func session(t *testing.T, messages ...map[string]interface{}) []map[string]interface{} {
+	var in, out bytes.Buffer
+	messages = append(messages,
+		map[string]interface{}{"id": 1000, "method": "shutdown"},
+		map[string]interface{}{"method": "exit"},
+	)
+	for _, msg := range messages {
+		msg["jsonrpc"] = "2.0"
+		require.NoError(t, framing.WriteMessage(&in, msg))
+	}
+	require.NoError(t, Serve(&in, &out))
+
+	var received []map[string]interface{}
+	r := bufio.NewReader(&out)
+	for {
+		b, err := framing.ReadMessage(r)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		var msg map[string]interface{}
+		require.NoError(t, json.Unmarshal(b, &msg))
+		received = append(received, msg)
+	}
+	return received[:len(received)-1]
+}
+
+func open(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"method": "textDocument/didOpen",
+		"params": map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": "file:///test.lox", "languageId": "lox", "version": 1, "text": text},
+		},
+	}
+}
+
+func request(id int, method string, line int, character int) map[string]interface{} {
+	return map[string]interface{}{
+		"id":     id,
+		"method": method,
+		"params": map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": "file:///test.lox"},
+			"position":     map[string]interface{}{"line": line, "character": character},
+			"context":      map[string]interface{}{"includeDeclaration": true},
+		},
+	}
+}
+
+func rangeAt(line int, start int, end int) map[string]interface{} {
+	return map[string]interface{}{
+		"start": map[string]interface{}{"line": float64(line), "character": float64(start)},
+		"end":   map[string]interface{}{"line": float64(line), "character": float64(end)},
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	received := session(t, open("print \"é\" +;\n"))
+	require.Len(t, received, 1)
+	require.Equal(t, "textDocument/publishDiagnostics", received[0]["method"])
+	diagnostics := received[0]["params"].(map[string]interface{})["diagnostics"].([]interface{})
+	require.Len(t, diagnostics, 1)
+	diagnostic := diagnostics[0].(map[string]interface{})
+	require.Equal(t, "Expect expression.", diagnostic["message"])
+	require.Equal(t, rangeAt(0, 11, 12), diagnostic["range"])
+}
+
+func TestNavigation(t *testing.T) {
+	source := `fun add(a, b) {
+  return a + b;
+}
+print add(1, 2);
+`
+	received := session(t,
+		open(source),
+		request(1, "textDocument/definition", 3, 7),
+		request(2, "textDocument/references", 0, 5),
+		request(3, "textDocument/hover", 3, 7),
+		request(4, "textDocument/documentSymbol", 0, 0),
+		request(5, "textDocument/completion", 1, 9),
+		request(6, "textDocument/definition", 3, 0),
+		request(7, "textDocument/unknown", 0, 0),
+	)
+	require.Len(t, received, 8)
+	results := make(map[float64]interface{})
+	for _, msg := range received[1:] {
+		results[msg["id"].(float64)] = msg["result"]
+	}
+
+	require.Equal(t, rangeAt(0, 4, 7), results[1].(map[string]interface{})["range"])
+
+	references := results[2].([]interface{})
+	require.Len(t, references, 2)
+	require.Equal(t, rangeAt(3, 6, 9), references[1].(map[string]interface{})["range"])
+
+	contents := results[3].(map[string]interface{})["contents"].(map[string]interface{})
+	require.Equal(t, "```lox\nfun add(a, b)\n```", contents["value"])
+
+	symbols := results[4].([]interface{})
+	require.Len(t, symbols, 1)
+	require.Equal(t, "add", symbols[0].(map[string]interface{})["name"])
+
+	var labels []string
+	for _, item := range results[5].([]interface{}) {
+		labels = append(labels, item.(map[string]interface{})["label"].(string))
+	}
+	require.Equal(t, []string{"a", "add", "b"}, labels)
+
+	require.Nil(t, results[6])
+
+	require.Nil(t, results[7])
+	require.Equal(t, float64(methodNotFound), received[7]["error"].(map[string]interface{})["code"])
+}
+
+func TestInvalidNotification(t *testing.T) {
+	received := session(t,
+		map[string]interface{}{"method": "textDocument/didOpen", "params": map[string]interface{}{"textDocument": 1}},
+		open("print 1;"),
+	)
+	require.Len(t, received, 2)
+	require.Equal(t, "window/logMessage", received[0]["method"])
+	params := received[0]["params"].(map[string]interface{})
+	require.Equal(t, float64(errorMessageType), params["type"])
+	require.Contains(t, params["message"], "textDocument/didOpen: ")
+	require.Equal(t, "textDocument/publishDiagnostics", received[1]["method"])
+}
+
+func TestExitWithoutShutdown(t *testing.T) {
+	var in bytes.Buffer
+	require.NoError(t, framing.WriteMessage(&in, map[string]interface{}{"jsonrpc": "2.0", "method": "exit"}))
+	require.Error(t, Serve(&in, io.Discard))
+}
+
+func TestPositions(t *testing.T) {
+	text := "a\n\"é😀\" x\n"
+	offset := len("a\n\"é😀\" ")
+	p := positionOf(text, offset)
+	require.Equal(t, position{Line: 1, Character: 6}, p)
+	require.Equal(t, offset, offsetOf(text, p))
+	require.Equal(t, len("a"), offsetOf(text, position{Line: 0, Character: 10}))
+	require.Equal(t, len(text), offsetOf(text, position{Line: 5, Character: 0}))
+}
@@ -0,0 +1,266 @@
+package lox
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+var (
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+	callableType = reflect.TypeOf((*LoxCallable)(nil)).Elem()
+)
+
+// DefineNative defines a global function implemented in Go, which is visible
+// from all modules.
+//
+// fn must be a func. Its arguments are converted from Lox values as follows:
+// numbers to any Go integer or floating point type (integers must not have a
+// fractional part), strings to string, booleans to bool, lists to slices, maps
+// to Go maps, and anything to interface{}. Other values, such as Go pointers
+// previously returned by a native function, are passed as is if they are
+// assignable to the parameter type. Since the types of Lox functions, classes
+// and instances depend on the backend (see Eval), parameters that receive
+// them should be interface{}. The results are converted back the same way.
+//
+// fn may return no results, a single value, an error, or a value and an
+// error. A non-nil error is raised as a RuntimeError at the call site. Results
+// that can't be represented in Lox, such as funcs, channels and structs other
+// than LoxCallables, are rejected by DefineNative, or raise a RuntimeError if
+// they are held by an interface.
+// Variadic functions accept any number of trailing arguments.
+func (i *Interpreter) DefineNative(name string, fn interface{}) error {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return fmt.Errorf("native function %s: expected a func, got %T", name, fn)
+	}
+	t := v.Type()
+	switch t.NumOut() {
+	case 0, 1:
+	case 2:
+		if t.Out(1) != errorType {
+			return fmt.Errorf("native function %s: second result must be an error", name)
+		}
+	default:
+		return fmt.Errorf("native function %s: too many results", name)
+	}
+	if t.NumOut() > 0 && t.Out(0) != errorType && !convertible(t.Out(0)) {
+		return fmt.Errorf("native function %s: result type %s can't be converted to a Lox value", name, t.Out(0))
+	}
+	arity := t.NumIn()
+	if t.IsVariadic() {
+		arity = -1
+	}
+	i.builtins.define(name, &nativeFunction{name, v, arity})
+	return nil
+}
+
+// nativeFunction is a Go func registered with DefineNative.
+type nativeFunction struct {
+	name  string
+	fn    reflect.Value
+	arity int
+}
+
+func (n *nativeFunction) Arity() int { return n.arity }
+
+func (n *nativeFunction) Call(interpreter *Interpreter, arguments []interface{}) interface{} {
+	token := interpreter.callToken()
+	t := n.fn.Type()
+
+	if t.IsVariadic() && len(arguments) < t.NumIn()-1 {
+		panic(NewRuntimeError(token, fmt.Sprintf("Expected at least %d arguments but got %d.", t.NumIn()-1, len(arguments))))
+	}
+
+	in := make([]reflect.Value, len(arguments))
+	for k, argument := range arguments {
+		var paramType reflect.Type
+		if t.IsVariadic() && k >= t.NumIn()-1 {
+			paramType = t.In(t.NumIn() - 1).Elem()
+		} else {
+			paramType = t.In(k)
+		}
+		v, err := toGo(argument, paramType)
+		if err != nil {
+			panic(NewRuntimeError(token, fmt.Sprintf("Argument %d of '%s' %s.", k+1, n.name, err)))
+		}
+		in[k] = v
+	}
+
+	out := n.fn.Call(in)
+
+	if len(out) > 0 && t.Out(len(out)-1) == errorType {
+		if err := out[len(out)-1]; !err.IsNil() {
+			panic(NewRuntimeError(token, err.Interface().(error).Error()))
+		}
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	result, err := fromGo(out[0])
+	if err != nil {
+		panic(NewRuntimeError(token, fmt.Sprintf("Result of '%s' %s.", n.name, err)))
+	}
+	return result
+}
+
+func (n *nativeFunction) String() string { return "<native fn " + n.name + ">" }
+
+// toGo converts a Lox value to a Go value of the given type.
+func toGo(value interface{}, t reflect.Type) (reflect.Value, error) {
+	switch t.Kind() {
+	case reflect.Bool:
+		if b, ok := value.(bool); ok {
+			return reflect.ValueOf(b).Convert(t), nil
+		}
+		return reflect.Value{}, errors.New("must be a boolean")
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := value.(float64)
+		if !ok || n != math.Trunc(n) {
+			return reflect.Value{}, errors.New("must be an integer")
+		}
+		return reflect.ValueOf(int64(n)).Convert(t), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, ok := value.(float64)
+		if !ok || n != math.Trunc(n) || n < 0 {
+			return reflect.Value{}, errors.New("must be a non-negative integer")
+		}
+		return reflect.ValueOf(uint64(n)).Convert(t), nil
+
+	case reflect.Float32, reflect.Float64:
+		if n, ok := value.(float64); ok {
+			return reflect.ValueOf(n).Convert(t), nil
+		}
+		return reflect.Value{}, errors.New("must be a number")
+
+	case reflect.String:
+		if s, ok := value.(string); ok {
+			return reflect.ValueOf(s).Convert(t), nil
+		}
+		return reflect.Value{}, errors.New("must be a string")
+
+	case reflect.Slice:
+		if list, ok := value.(*LoxList); ok {
+			slice := reflect.MakeSlice(t, len(list.elements), len(list.elements))
+			for k, element := range list.elements {
+				v, err := toGo(element, t.Elem())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("element %d %s", k, err)
+				}
+				slice.Index(k).Set(v)
+			}
+			return slice, nil
+		}
+
+	case reflect.Map:
+		if m, ok := value.(*LoxMap); ok {
+			result := reflect.MakeMapWithSize(t, len(m.order))
+			for _, entry := range m.order {
+				k, err := toGo(entry.key, t.Key())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("key %s", err)
+				}
+				v, err := toGo(entry.value, t.Elem())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("value %s", err)
+				}
+				result.SetMapIndex(k, v)
+			}
+			return result, nil
+		}
+	}
+
+	if value == nil {
+		switch t.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Func, reflect.Slice, reflect.Map, reflect.Chan:
+			return reflect.Zero(t), nil
+		}
+	} else if v := reflect.ValueOf(value); v.Type().AssignableTo(t) {
+		return v, nil
+	}
+	return reflect.Value{}, fmt.Errorf("can't be converted to %s", t)
+}
+
+// convertible reports whether fromGo can convert the values of a type. For
+// interfaces it depends on the dynamic type of each value.
+func convertible(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String, reflect.Interface, reflect.Ptr,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice, reflect.Array:
+		return convertible(t.Elem())
+	case reflect.Map:
+		return convertible(t.Key()) && convertible(t.Elem())
+	}
+	// Natives such as Clock are structs.
+	return t.Implements(callableType)
+}
+
+// fromGo converts a Go value to a Lox value. Pointers, such as the Lox values
+// held by an interface{}, are kept as is.
+func fromGo(v reflect.Value) (interface{}, error) {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil, nil
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Kind() == reflect.Interface {
+			return fromGo(v.Elem())
+		}
+		return v.Interface(), nil
+	case reflect.Slice, reflect.Array:
+		elements := make([]interface{}, v.Len())
+		for k := range elements {
+			element, err := fromGo(v.Index(k))
+			if err != nil {
+				return nil, err
+			}
+			elements[k] = element
+		}
+		return NewLoxList(elements), nil
+	case reflect.Map:
+		// Go maps are unordered; sort the keys so that the result is
+		// deterministic.
+		keys := v.MapKeys()
+		sort.Slice(keys, func(a, b int) bool {
+			return fmt.Sprint(keys[a].Interface()) < fmt.Sprint(keys[b].Interface())
+		})
+		m := NewLoxMap()
+		for _, key := range keys {
+			k, err := fromGo(key)
+			if err != nil {
+				return nil, err
+			}
+			value, err := fromGo(v.MapIndex(key))
+			if err != nil {
+				return nil, err
+			}
+			m.setIndex(nil, k, value)
+		}
+		return m, nil
+	}
+	if v.Type().Implements(callableType) {
+		return v.Interface(), nil
+	}
+	return nil, fmt.Errorf("can't be converted from %s", v.Type())
+}
@@ -0,0 +1,112 @@
+package lox
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefineNative(t *testing.T) {
+	i := NewInterpreter()
+	require.NoError(t, i.DefineNative("repeat", strings.Repeat))
+	require.NoError(t, i.DefineNative("sum", func(xs ...float64) float64 {
+		total := 0.0
+		for _, x := range xs {
+			total += x
+		}
+		return total
+	}))
+	require.NoError(t, i.DefineNative("split", strings.Split))
+	require.NoError(t, i.DefineNative("fail", func(msg string) (string, error) {
+		return "", errors.New(msg)
+	}))
+	require.Error(t, i.DefineNative("notAFunction", 42))
+
+	v, err := i.Eval(`repeat("ab", 3);`, "")
+	require.NoError(t, err)
+	require.Equal(t, "ababab", v)
+
+	v, err = i.Eval(`sum() + sum(1, 2, 3);`, "")
+	require.NoError(t, err)
+	require.Equal(t, 6.0, v)
+
+	v, err = i.Eval(`split("a,b", ",");`, "")
+	require.NoError(t, err)
+	require.Equal(t, `["a", "b"]`, stringify(v))
+
+	_, err = i.Eval(`repeat("ab", 1.5);`, "")
+	require.EqualError(t, err, "Argument 2 of 'repeat' must be an integer.")
+
+	_, err = i.Eval(`repeat("ab");`, "")
+	require.EqualError(t, err, "Expected 2 arguments but got 1.")
+
+	_, err = i.Eval("\nfail(\"boom\");", "")
+	require.EqualError(t, err, "boom")
+	require.Equal(t, 2, err.(RuntimeError).Token.Line())
+}
+
+func TestCallNativeFromGo(t *testing.T) {
+	i := NewInterpreter()
+	require.NoError(t, i.DefineNative("repeat", strings.Repeat))
+	v, err := i.Eval("repeat;", "")
+	require.NoError(t, err)
+
+	repeat := v.(LoxCallable)
+	require.Equal(t, "abab", repeat.Call(i, []interface{}{"ab", 2.0}))
+	require.PanicsWithError(t, "Argument 2 of 'repeat' must be an integer.", func() {
+		repeat.Call(i, []interface{}{"ab", 1.5})
+	})
+}
+
+func TestDefineNativeLoxObjects(t *testing.T) {
+	for _, backend := range []Backend{TreeWalker, BytecodeVM} {
+		i := NewInterpreter(WithBackend(backend))
+		require.NoError(t, i.DefineNative("describe", func(v interface{}) string {
+			s, fields := Inspect(v)
+			return fmt.Sprintf("%s %d", s, len(fields))
+		}))
+		require.NoError(t, i.DefineNative("identity", func(v interface{}) interface{} { return v }))
+
+		v, err := i.Eval(`class A {} var a = A(); a.x = 1;
+var f = fun () {};
+identity(a) == a and identity(f) == f and identity(A) == A;`, "")
+		require.NoError(t, err)
+		require.Equal(t, true, v)
+
+		v, err = i.Eval("describe(a);", "")
+		require.NoError(t, err)
+		require.Equal(t, "A instance 1", v)
+	}
+}
+
+func TestDefineNativeUnsupportedResults(t *testing.T) {
+	i := NewInterpreter()
+	require.EqualError(t, i.DefineNative("f", func() func() { return nil }),
+		"native function f: result type func() can't be converted to a Lox value")
+	require.EqualError(t, i.DefineNative("s", func() struct{ X int } { return struct{ X int }{} }),
+		"native function s: result type struct { X int } can't be converted to a Lox value")
+	require.Error(t, i.DefineNative("fs", func() []func() { return nil }))
+	require.NoError(t, i.DefineNative("clockFn", func() LoxCallable { return Clock{} }))
+
+	// Values held by an interface are checked when the native is called.
+	require.NoError(t, i.DefineNative("any", func(kind string) interface{} {
+		switch kind {
+		case "func":
+			return func() {}
+		case "list":
+			return []interface{}{1, func() {}}
+		}
+		return Clock{}
+	}))
+	_, err := i.Eval(`any("func") == any("func");`, "")
+	require.EqualError(t, err, "Result of 'any' can't be converted from func().")
+	_, err = i.Eval(`var m = {}; m[any("list")] = 1;`, "")
+	require.EqualError(t, err, "Result of 'any' can't be converted from func().")
+
+	v, err := i.Eval(`any("clock") == clockFn();`, "")
+	require.NoError(t, err)
+	require.Equal(t, true, v)
+}
@@ -0,0 +1,335 @@
+package lox
+
+// Optimizer simplifies a resolved program without changing its behavior:
+// it folds operations on literals, removes the branches and loops whose
+// condition is a literal that is never true, and removes groupings.
+//
+// Operations that would raise a RuntimeError, such as "a" - 1, are left alone
+// so that the error is still raised, at the same token, when the code runs.
+type Optimizer struct{}
+
+func NewOptimizer() *Optimizer {
+	return &Optimizer{}
+}
+
+// Optimize returns the optimized statements. The syntax tree is modified in
+// place.
+func (o *Optimizer) Optimize(statements []Stmt) []Stmt {
+	return o.stmts(statements)
+}
+
+func (o *Optimizer) stmts(statements []Stmt) []Stmt {
+	optimized := statements[:0]
+	for _, statement := range statements {
+		if statement := o.stmt(statement); statement != nil {
+			optimized = append(optimized, statement)
+		}
+	}
+	return optimized
+}
+
+// stmt returns the optimized statement, or nil if it does nothing.
+func (o *Optimizer) stmt(stmt Stmt) Stmt {
+	if optimized := stmt.accept(o); optimized != nil {
+		return optimized.(Stmt)
+	}
+	return nil
+}
+
+// body is like stmt, but returns an empty block instead of nil.
+func (o *Optimizer) body(stmt Stmt) Stmt {
+	if optimized := o.stmt(stmt); optimized != nil {
+		return optimized
+	}
+	return NewBlock(nil)
+}
+
+func (o *Optimizer) expr(expr Expr) Expr {
+	if expr == nil {
+		return nil
+	}
+	return expr.accept(o).(Expr)
+}
+
+func (o *Optimizer) exprs(exprs []Expr) {
+	for k := range exprs {
+		exprs[k] = o.expr(exprs[k])
+	}
+}
+
+func (o *Optimizer) function(function *Function) {
+	function.body = o.stmts(function.body)
+}
+
+// literal returns the value of the expression if it is a literal.
+func literal(expr Expr) (value interface{}, ok bool) {
+	if l, ok := expr.(*Literal); ok {
+		return l.value, true
+	}
+	return nil, false
+}
+
+func (o *Optimizer) visitAssertStmt(stmt *Assert) interface{} {
+	stmt.condition = o.expr(stmt.condition)
+	stmt.message = o.expr(stmt.message)
+	return stmt
+}
+
+func (o *Optimizer) visitBlockStmt(stmt *Block) interface{} {
+	stmt.statements = o.stmts(stmt.statements)
+	return stmt
+}
+
+func (o *Optimizer) visitBreakStmt(stmt *Break) interface{} {
+	return stmt
+}
+
+func (o *Optimizer) visitClassStmt(stmt *Class) interface{} {
+	for _, method := range stmt.methods {
+		o.function(method)
+	}
+	return stmt
+}
+
+func (o *Optimizer) visitContinueStmt(stmt *Continue) interface{} {
+	return stmt
+}
+
+func (o *Optimizer) visitExpressionStmt(stmt *Expression) interface{} {
+	stmt.expression = o.expr(stmt.expression)
+	return stmt
+}
+
+func (o *Optimizer) visitFunctionStmt(stmt *Function) interface{} {
+	o.function(stmt)
+	return stmt
+}
+
+func (o *Optimizer) visitIfStmt(stmt *If) interface{} {
+	stmt.condition = o.expr(stmt.condition)
+	if condition, ok := literal(stmt.condition); ok {
+		if isTruthy(condition) {
+			return o.stmt(stmt.thenBranch)
+		}
+		if stmt.elseBranch == nil {
+			return nil
+		}
+		return o.stmt(stmt.elseBranch)
+	}
+
+	stmt.thenBranch = o.body(stmt.thenBranch)
+	if stmt.elseBranch != nil {
+		stmt.elseBranch = o.stmt(stmt.elseBranch)
+	}
+	return stmt
+}
+
+func (o *Optimizer) visitImportStmt(stmt *Import) interface{} {
+	return stmt
+}
+
+func (o *Optimizer) visitPrintStmt(stmt *Print) interface{} {
+	stmt.expression = o.expr(stmt.expression)
+	return stmt
+}
+
+func (o *Optimizer) visitReturnStmt(stmt *Return) interface{} {
+	stmt.value = o.expr(stmt.value)
+	return stmt
+}
+
+func (o *Optimizer) visitThrowStmt(stmt *Throw) interface{} {
+	stmt.value = o.expr(stmt.value)
+	return stmt
+}
+
+func (o *Optimizer) visitTryStmt(stmt *Try) interface{} {
+	o.visitBlockStmt(stmt.body)
+	if stmt.catchBody != nil {
+		o.visitBlockStmt(stmt.catchBody)
+	}
+	if stmt.finallyBody != nil {
+		o.visitBlockStmt(stmt.finallyBody)
+	}
+	return stmt
+}
+
+func (o *Optimizer) visitVarStmt(stmt *Var) interface{} {
+	stmt.initializer = o.expr(stmt.initializer)
+	return stmt
+}
+
+func (o *Optimizer) visitWhileStmt(stmt *While) interface{} {
+	stmt.condition = o.expr(stmt.condition)
+	if condition, ok := literal(stmt.condition); ok && !isTruthy(condition) {
+		return nil
+	}
+	stmt.body = o.body(stmt.body)
+	stmt.increment = o.expr(stmt.increment)
+	return stmt
+}
+
+func (o *Optimizer) visitAssignExpr(expr *Assign) interface{} {
+	expr.value = o.expr(expr.value)
+	return expr
+}
+
+func (o *Optimizer) visitBinaryExpr(expr *Binary) interface{} {
+	expr.left = o.expr(expr.left)
+	expr.right = o.expr(expr.right)
+
+	left, ok := literal(expr.left)
+	if !ok {
+		return expr
+	}
+	right, ok := literal(expr.right)
+	if !ok {
+		return expr
+	}
+
+	switch expr.operator.kind {
+	case EQUAL_EQUAL:
+		return NewLiteral(isEqual(left, right))
+	case BANG_EQUAL:
+		return NewLiteral(!isEqual(left, right))
+	case PLUS:
+		if left, ok := left.(string); ok {
+			if right, ok := right.(string); ok {
+				return NewLiteral(left + right)
+			}
+			return expr
+		}
+	}
+
+	l, ok := left.(float64)
+	if !ok {
+		return expr
+	}
+	r, ok := right.(float64)
+	if !ok {
+		return expr
+	}
+	switch expr.operator.kind {
+	case PLUS:
+		return NewLiteral(l + r)
+	case MINUS:
+		return NewLiteral(l - r)
+	case STAR:
+		return NewLiteral(l * r)
+	case SLASH:
+		return NewLiteral(l / r)
+	case GREATER:
+		return NewLiteral(l > r)
+	case GREATER_EQUAL:
+		return NewLiteral(l >= r)
+	case LESS:
+		return NewLiteral(l < r)
+	case LESS_EQUAL:
+		return NewLiteral(l <= r)
+	}
+	return expr
+}
+
+func (o *Optimizer) visitCallExpr(expr *Call) interface{} {
+	expr.callee = o.expr(expr.callee)
+	o.exprs(expr.arguments)
+	return expr
+}
+
+func (o *Optimizer) visitGetExpr(expr *Get) interface{} {
+	expr.object = o.expr(expr.object)
+	return expr
+}
+
+func (o *Optimizer) visitGroupingExpr(expr *Grouping) interface{} {
+	return o.expr(expr.expression)
+}
+
+func (o *Optimizer) visitIndexExpr(expr *Index) interface{} {
+	expr.object = o.expr(expr.object)
+	expr.index = o.expr(expr.index)
+	return expr
+}
+
+func (o *Optimizer) visitLambdaExpr(expr *Lambda) interface{} {
+	o.function(expr.declaration)
+	return expr
+}
+
+func (o *Optimizer) visitListExpr(expr *List) interface{} {
+	o.exprs(expr.elements)
+	return expr
+}
+
+func (o *Optimizer) visitLiteralExpr(expr *Literal) interface{} {
+	return expr
+}
+
+func (o *Optimizer) visitLogicalExpr(expr *Logical) interface{} {
+	expr.left = o.expr(expr.left)
+	expr.right = o.expr(expr.right)
+
+	left, ok := literal(expr.left)
+	if !ok {
+		return expr
+	}
+	if expr.operator.kind == OR {
+		if isTruthy(left) {
+			return expr.left
+		}
+	} else { // AND
+		if !isTruthy(left) {
+			return expr.left
+		}
+	}
+	return expr.right
+}
+
+func (o *Optimizer) visitMapExpr(expr *Map) interface{} {
+	o.exprs(expr.keys)
+	o.exprs(expr.values)
+	return expr
+}
+
+func (o *Optimizer) visitSetExpr(expr *Set) interface{} {
+	expr.object = o.expr(expr.object)
+	expr.value = o.expr(expr.value)
+	return expr
+}
+
+func (o *Optimizer) visitSetIndexExpr(expr *SetIndex) interface{} {
+	expr.object = o.expr(expr.object)
+	expr.index = o.expr(expr.index)
+	expr.value = o.expr(expr.value)
+	return expr
+}
+
+func (o *Optimizer) visitSuperExpr(expr *Super) interface{} {
+	return expr
+}
+
+func (o *Optimizer) visitThisExpr(expr *This) interface{} {
+	return expr
+}
+
+func (o *Optimizer) visitUnaryExpr(expr *Unary) interface{} {
+	expr.right = o.expr(expr.right)
+
+	right, ok := literal(expr.right)
+	if !ok {
+		return expr
+	}
+	switch expr.operator.kind {
+	case BANG:
+		return NewLiteral(!isTruthy(right))
+	case MINUS:
+		if right, ok := right.(float64); ok {
+			return NewLiteral(-right)
+		}
+	}
+	return expr
+}
+
+func (o *Optimizer) visitVariableExpr(expr *Variable) interface{} {
+	return expr
+}
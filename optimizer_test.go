@@ -0,0 +1,55 @@
+package lox
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func optimize(t *testing.T, source string) []Stmt {
+	statements, diagnostics := NewInterpreter(WithOptimizer(true)).compile(source, "")
+	require.NoError(t, diagnostics.Err())
+	return statements
+}
+
+func TestOptimizerFoldsLiterals(t *testing.T) {
+	tests := map[string]interface{}{
+		"print 1 + 2 * (3 - 1);":          5.0,
+		`print "a" + ("b" + "c");`:        "abc",
+		"print !nil and 1 < 2;":           true,
+		"print nil or false;":             false,
+		`print -(1 / 2) == -0.5 != true;`: false,
+	}
+	for source, expected := range tests {
+		statements := optimize(t, source)
+		require.Len(t, statements, 1)
+		require.Equal(t, NewLiteral(expected), statements[0].(*Print).expression, source)
+	}
+
+	// Operands that are not literals are kept.
+	statements := optimize(t, "var a; print a + (1 + 2);")
+	binary := statements[1].(*Print).expression.(*Binary)
+	require.IsType(t, &Variable{}, binary.left)
+	require.Equal(t, NewLiteral(3.0), binary.right)
+}
+
+func TestOptimizerRemovesDeadCode(t *testing.T) {
+	statements := optimize(t, "if (false) print 1; else print 2; while (false) print 3; if (nil) print 4;")
+	require.Len(t, statements, 1)
+	require.Equal(t, NewLiteral(2.0), statements[0].(*Print).expression)
+
+	statements = optimize(t, "for (var i = 0; 1 > 2; i = i + 1) print i;")
+	require.Len(t, statements, 1)
+	require.Len(t, statements[0].(*Block).statements, 1)
+	require.IsType(t, &Var{}, statements[0].(*Block).statements[0])
+}
+
+func TestOptimizerPreservesErrors(t *testing.T) {
+	for _, source := range []string{`print "a" - 1;`, `print (1 + "a") + 2;`, "print -(nil);", `print 1 < "b";`} {
+		_, expected := NewInterpreter().Eval(source, "")
+		_, err := NewInterpreter(WithOptimizer(true)).Eval(source, "")
+		require.Error(t, err)
+		require.Equal(t, expected.Error(), err.Error(), source)
+		require.Equal(t, expected.(RuntimeError).Token, err.(RuntimeError).Token, source)
+	}
+}
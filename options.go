@@ -0,0 +1,70 @@
+package lox
+
+import (
+	"fmt"
+	"io"
+)
+
+// Option configures an Interpreter.
+type Option func(*Interpreter)
+
+// WithStdout sets the writer for the output of print statements. The default
+// is os.Stdout.
+func WithStdout(w io.Writer) Option {
+	return func(i *Interpreter) { i.stdout = w }
+}
+
+// WithStderr sets the writer where Report prints errors. The default is
+// os.Stderr.
+func WithStderr(w io.Writer) Option {
+	return func(i *Interpreter) { i.stderr = w }
+}
+
+// WithStdin sets the reader for the input of the script. The default is
+// os.Stdin.
+func WithStdin(r io.Reader) Option {
+	return func(i *Interpreter) { i.stdin = r }
+}
+
+// Backend selects how an Interpreter executes the code.
+type Backend int
+
+const (
+	// TreeWalker evaluates the syntax tree directly. It is the default.
+	TreeWalker Backend = iota
+	// BytecodeVM compiles the syntax tree to bytecode, which is executed by
+	// a stack-based virtual machine.
+	BytecodeVM
+)
+
+// WithBackend sets the backend that executes the code.
+func WithBackend(backend Backend) Option {
+	return func(i *Interpreter) { i.backend = backend }
+}
+
+// WithOptimizer enables the Optimizer pass, which runs after the Resolver.
+func WithOptimizer(enabled bool) Option {
+	return func(i *Interpreter) { i.optimize = enabled }
+}
+
+// Stdout returns the writer for the output of the script.
+func (i *Interpreter) Stdout() io.Writer { return i.stdout }
+
+// Stderr returns the writer for diagnostics.
+func (i *Interpreter) Stderr() io.Writer { return i.stderr }
+
+// Stdin returns the reader for the input of the script.
+func (i *Interpreter) Stdin() io.Reader { return i.stdin }
+
+// Report prints an error returned by Eval or Interpret to the diagnostics
+// writer, along with the offending source code.
+func (i *Interpreter) Report(err error) {
+	switch err := err.(type) {
+	case Diagnostics:
+		fmt.Fprint(i.stderr, err.Render())
+	case RuntimeError:
+		fmt.Fprint(i.stderr, err.Render())
+	default:
+		fmt.Fprintln(i.stderr, err)
+	}
+}
@@ -1,24 +1,48 @@
 package lox
 
-import "errors"
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+)
 
 type ParseError error
 
 type Parser struct {
-	tokens  []*Token
-	current int
+	tokens      []*Token
+	current     int
+	diagnostics Diagnostics
 }
 
 func NewParser(tokens []*Token) *Parser {
 	return &Parser{tokens: tokens}
 }
 
-func (p *Parser) Parse() []Stmt {
+func (p *Parser) Parse() ([]Stmt, Diagnostics) {
 	var statements []Stmt
 	for !p.isAtEnd() {
 		statements = append(statements, p.declaration())
 	}
-	return statements
+	return statements, p.diagnostics
+}
+
+// ParseExpression parses the tokens as a single expression, which is nil if
+// there are errors.
+func (p *Parser) ParseExpression() (expr Expr, diagnostics Diagnostics) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(ParseError); ok {
+				expr, diagnostics = nil, p.diagnostics
+				return
+			}
+			panic(r)
+		}
+	}()
+	expr = p.expression()
+	if !p.isAtEnd() {
+		panic(p.error(p.peek(), "Expect end of expression."))
+	}
+	return expr, p.diagnostics
 }
 
 func (p *Parser) declaration() Stmt {
@@ -32,15 +56,43 @@ func (p *Parser) declaration() Stmt {
 		}
 	}()
 
-	if p.match(FUN) {
+	if p.match(CLASS) {
+		return p.classDeclaration()
+	}
+	if p.check(FUN) && p.checkNext(IDENTIFIER) {
+		p.advance()
 		return p.function("function")
 	}
 	if p.match(VAR) {
 		return p.varDeclaration()
 	}
+	if p.match(IMPORT) {
+		return p.importDeclaration()
+	}
 	return p.statement()
 }
 
+func (p *Parser) classDeclaration() Stmt {
+	name := p.consume(IDENTIFIER, "Expect class name.")
+
+	var superclass *Variable
+	if p.match(LESS) {
+		p.consume(IDENTIFIER, "Expect superclass name.")
+		superclass = NewVariable(p.previous())
+	}
+
+	p.consume(LEFT_BRACE, "Expect '{' before class body.")
+
+	var methods []*Function
+	for !p.check(RIGHT_BRACE) && !p.isAtEnd() {
+		methods = append(methods, p.function("method"))
+	}
+
+	p.consume(RIGHT_BRACE, "Expect '}' after class body.")
+
+	return NewClass(name, superclass, methods)
+}
+
 func (p *Parser) varDeclaration() Stmt {
 	name := p.consume(IDENTIFIER, "Expect variable name.")
 
@@ -53,15 +105,57 @@ func (p *Parser) varDeclaration() Stmt {
 	return NewVar(name, initializer)
 }
 
+func (p *Parser) importDeclaration() Stmt {
+	keyword := p.previous()
+	path := p.consume(STRING, "Expect module path after 'import'.")
+
+	var name *Token
+	var names []*Token
+	if p.check(IDENTIFIER) && p.peek().lexeme == "as" {
+		p.advance()
+		name = p.consume(IDENTIFIER, "Expect module name after 'as'.")
+	} else if p.match(FOR) {
+		for {
+			names = append(names, p.consume(IDENTIFIER, "Expect name to import."))
+			if !p.match(COMMA) {
+				break
+			}
+		}
+	} else {
+		// Bind the module to the name of the file, without the extension.
+		base := filepath.Base(path.literal.(string))
+		base = strings.TrimSuffix(base, filepath.Ext(base))
+		if !isIdentifier(base) {
+			panic(p.error(path, "Module file name is not a valid identifier; use 'as' to name it."))
+		}
+		name = &Token{}
+		*name = *path
+		name.kind, name.lexeme, name.literal = IDENTIFIER, base, nil
+	}
+
+	p.consume(SEMICOLON, "Expect ';' after import.")
+	return NewImport(keyword, path, name, names)
+}
+
 func (p *Parser) whileStatement() Stmt {
+	keyword := p.previous()
 	p.consume(LEFT_PAREN, "Expect '(' after 'while'.")
 	condition := p.expression()
 	p.consume(RIGHT_PAREN, "Expect ')' after condition.")
 	body := p.statement()
-	return NewWhile(condition, body)
+	return NewWhile(keyword, condition, body, nil)
 }
 
 func (p *Parser) statement() Stmt {
+	if p.match(ASSERT) {
+		return p.assertStatement()
+	}
+	if p.match(BREAK) {
+		return p.breakStatement()
+	}
+	if p.match(CONTINUE) {
+		return p.continueStatement()
+	}
 	if p.match(FOR) {
 		return p.forStatement()
 	}
@@ -74,6 +168,12 @@ func (p *Parser) statement() Stmt {
 	if p.match(RETURN) {
 		return p.returnStatement()
 	}
+	if p.match(THROW) {
+		return p.throwStatement()
+	}
+	if p.match(TRY) {
+		return p.tryStatement()
+	}
 	if p.match(WHILE) {
 		return p.whileStatement()
 	}
@@ -83,7 +183,37 @@ func (p *Parser) statement() Stmt {
 	return p.expressionStatement()
 }
 
+func (p *Parser) assertStatement() Stmt {
+	keyword := p.previous()
+	first := p.peek()
+	condition := p.expression()
+	// The source text of the condition is kept for the failure message.
+	text := ExprToString(condition)
+	if last := p.previous(); first.source != nil {
+		text = first.source.Text[first.offset:last.end]
+	}
+	var message Expr
+	if p.match(COMMA) {
+		message = p.expression()
+	}
+	p.consume(SEMICOLON, "Expect ';' after assertion.")
+	return NewAssert(keyword, condition, message, text)
+}
+
+func (p *Parser) breakStatement() Stmt {
+	keyword := p.previous()
+	p.consume(SEMICOLON, "Expect ';' after 'break'.")
+	return NewBreak(keyword)
+}
+
+func (p *Parser) continueStatement() Stmt {
+	keyword := p.previous()
+	p.consume(SEMICOLON, "Expect ';' after 'continue'.")
+	return NewContinue(keyword)
+}
+
 func (p *Parser) forStatement() Stmt {
+	keyword := p.previous()
 	p.consume(LEFT_PAREN, "Expect '(' after 'for'.")
 
 	var initializer Stmt
@@ -108,14 +238,13 @@ func (p *Parser) forStatement() Stmt {
 	p.consume(RIGHT_PAREN, "Expect ')' after for clauses.")
 
 	body := p.statement()
-	if increment != nil {
-		body = NewBlock([]Stmt{body, NewExpression(increment)})
-	}
 
 	if condition == nil {
 		condition = NewLiteral(true)
 	}
-	body = NewWhile(condition, body)
+	// The increment is kept apart from the body so that it still runs after
+	// a continue statement.
+	body = NewWhile(keyword, condition, body, increment)
 
 	if initializer != nil {
 		body = NewBlock([]Stmt{initializer, body})
@@ -125,6 +254,7 @@ func (p *Parser) forStatement() Stmt {
 }
 
 func (p *Parser) ifStatement() Stmt {
+	keyword := p.previous()
 	p.consume(LEFT_PAREN, "Expect '(' after 'if'.")
 	condition := p.expression()
 	p.consume(RIGHT_PAREN, "Expect ')' after if condition.")
@@ -135,7 +265,7 @@ func (p *Parser) ifStatement() Stmt {
 		elseBranch = p.statement()
 	}
 
-	return NewIf(condition, thenBranch, elseBranch)
+	return NewIf(keyword, condition, thenBranch, elseBranch)
 }
 
 func (p *Parser) block() []Stmt {
@@ -148,9 +278,10 @@ func (p *Parser) block() []Stmt {
 }
 
 func (p *Parser) printStatement() Stmt {
+	keyword := p.previous()
 	value := p.expression()
 	p.consume(SEMICOLON, "Expect ';' after value.")
-	return NewPrint(value)
+	return NewPrint(keyword, value)
 }
 
 func (p *Parser) returnStatement() Stmt {
@@ -163,6 +294,41 @@ func (p *Parser) returnStatement() Stmt {
 	return NewReturn(keyword, value)
 }
 
+func (p *Parser) throwStatement() Stmt {
+	keyword := p.previous()
+	value := p.expression()
+	p.consume(SEMICOLON, "Expect ';' after thrown value.")
+	return NewThrow(keyword, value)
+}
+
+func (p *Parser) tryStatement() Stmt {
+	keyword := p.previous()
+	p.consume(LEFT_BRACE, "Expect '{' after 'try'.")
+	body := NewBlock(p.block())
+
+	var catchName *Token
+	var catchBody *Block
+	if p.match(CATCH) {
+		p.consume(LEFT_PAREN, "Expect '(' after 'catch'.")
+		catchName = p.consume(IDENTIFIER, "Expect error variable name.")
+		p.consume(RIGHT_PAREN, "Expect ')' after error variable name.")
+		p.consume(LEFT_BRACE, "Expect '{' before catch body.")
+		catchBody = NewBlock(p.block())
+	}
+
+	var finallyBody *Block
+	if p.match(FINALLY) {
+		p.consume(LEFT_BRACE, "Expect '{' after 'finally'.")
+		finallyBody = NewBlock(p.block())
+	}
+
+	if catchBody == nil && finallyBody == nil {
+		panic(p.error(p.peek(), "Expect 'catch' or 'finally' after try block."))
+	}
+
+	return NewTry(keyword, body, catchName, catchBody, finallyBody)
+}
+
 func (p *Parser) expressionStatement() Stmt {
 	expr := p.expression()
 	p.consume(SEMICOLON, "Expect ';' after expression.")
@@ -172,11 +338,17 @@ func (p *Parser) expressionStatement() Stmt {
 func (p *Parser) function(kind string) *Function {
 	name := p.consume(IDENTIFIER, "Expect "+kind+" name.")
 	p.consume(LEFT_PAREN, "Expect '(' after "+kind+" name.")
+	return p.functionBody(kind, name)
+}
+
+// functionBody parses the parameters and body of a function, after the
+// opening parenthesis. name is nil for anonymous functions.
+func (p *Parser) functionBody(kind string, name *Token) *Function {
 	var parameters []*Token
 	if !p.check(RIGHT_PAREN) {
 		for {
 			if len(parameters) >= 255 {
-				ReportTokenError(p.peek(), "Can't have more than 255 parameters.")
+				p.diagnostics.errorAt(p.peek(), "Can't have more than 255 parameters.")
 			}
 
 			parameters = append(parameters, p.consume(IDENTIFIER, "Expect parameter name."))
@@ -204,12 +376,16 @@ func (p *Parser) assignment() Expr {
 		equals := p.previous()
 		value := p.assignment()
 
-		if expr, ok := expr.(*Variable); ok {
-			name := expr.name
-			return NewAssign(name, value)
+		switch expr := expr.(type) {
+		case *Variable:
+			return NewAssign(expr.name, value)
+		case *Get:
+			return NewSet(expr.object, expr.name, value)
+		case *Index:
+			return NewSetIndex(expr.object, expr.bracket, expr.index, value)
 		}
 
-		ReportTokenError(equals, "Invalid assignment target.")
+		p.diagnostics.errorAt(equals, "Invalid assignment target.")
 	}
 
 	return expr
@@ -268,6 +444,13 @@ func (p *Parser) check(kind TokenType) bool {
 	return p.peek().kind == kind
 }
 
+func (p *Parser) checkNext(kind TokenType) bool {
+	if p.isAtEnd() {
+		return false
+	}
+	return p.tokens[p.current+1].kind == kind
+}
+
 func (p *Parser) advance() *Token {
 	if !p.isAtEnd() {
 		p.current++
@@ -337,6 +520,13 @@ func (p *Parser) call() Expr {
 	for {
 		if p.match(LEFT_PAREN) {
 			expr = p.finishCall(expr)
+		} else if p.match(DOT) {
+			name := p.consume(IDENTIFIER, "Expect property name after '.'.")
+			expr = NewGet(expr, name)
+		} else if p.match(LEFT_BRACKET) {
+			index := p.expression()
+			bracket := p.consume(RIGHT_BRACKET, "Expect ']' after index.")
+			expr = NewIndex(expr, bracket, index)
 		} else {
 			break
 		}
@@ -349,7 +539,7 @@ func (p *Parser) finishCall(callee Expr) Expr {
 	if !p.check(RIGHT_PAREN) {
 		for {
 			if len(arguments) >= 255 {
-				ReportTokenError(p.peek(), "Can't have more than 255 arguments.")
+				p.diagnostics.errorAt(p.peek(), "Can't have more than 255 arguments.")
 			}
 			arguments = append(arguments, p.expression())
 			if !p.match(COMMA) {
@@ -371,16 +561,62 @@ func (p *Parser) primary() Expr {
 		return NewLiteral(nil)
 	case p.match(NUMBER, STRING):
 		return NewLiteral(p.previous().literal)
+	case p.match(SUPER):
+		keyword := p.previous()
+		p.consume(DOT, "Expect '.' after 'super'.")
+		method := p.consume(IDENTIFIER, "Expect superclass method name.")
+		return NewSuper(keyword, method)
+	case p.match(THIS):
+		return NewThis(p.previous())
 	case (p.match(IDENTIFIER)):
 		return NewVariable(p.previous())
 	case p.match(LEFT_PAREN):
 		expr := p.expression()
 		p.consume(RIGHT_PAREN, "Expect ')' after expression.")
 		return NewGrouping(expr)
+	case p.match(LEFT_BRACKET):
+		return p.list()
+	case p.match(LEFT_BRACE):
+		return p.mapLiteral()
+	case p.match(FUN):
+		p.consume(LEFT_PAREN, "Expect '(' after 'fun'.")
+		return NewLambda(p.functionBody("function", nil))
 	}
 	panic(p.error(p.peek(), "Expect expression."))
 }
 
+func (p *Parser) list() Expr {
+	bracket := p.previous()
+	var elements []Expr
+	if !p.check(RIGHT_BRACKET) {
+		for {
+			elements = append(elements, p.expression())
+			if !p.match(COMMA) {
+				break
+			}
+		}
+	}
+	p.consume(RIGHT_BRACKET, "Expect ']' after list elements.")
+	return NewList(bracket, elements)
+}
+
+func (p *Parser) mapLiteral() Expr {
+	brace := p.previous()
+	var keys, values []Expr
+	if !p.check(RIGHT_BRACE) {
+		for {
+			keys = append(keys, p.expression())
+			p.consume(COLON, "Expect ':' after map key.")
+			values = append(values, p.expression())
+			if !p.match(COMMA) {
+				break
+			}
+		}
+	}
+	p.consume(RIGHT_BRACE, "Expect '}' after map entries.")
+	return NewMap(brace, keys, values)
+}
+
 func (p *Parser) consume(kind TokenType, message string) *Token {
 	if p.check(kind) {
 		return p.advance()
@@ -403,6 +639,8 @@ func (p *Parser) synchronize() {
 			return
 		case VAR:
 			return
+		case IMPORT:
+			return
 		case FOR:
 			return
 		case IF:
@@ -411,8 +649,14 @@ func (p *Parser) synchronize() {
 			return
 		case PRINT:
 			return
+		case ASSERT:
+			return
 		case RETURN:
 			return
+		case THROW:
+			return
+		case TRY:
+			return
 		}
 
 		p.advance()
@@ -420,6 +664,6 @@ func (p *Parser) synchronize() {
 }
 
 func (p *Parser) error(token *Token, message string) ParseError {
-	ReportTokenError(token, message)
+	p.diagnostics.errorAt(token, message)
 	return ParseError(errors.New(message))
 }
@@ -1,29 +1,61 @@
 package lox
 
+import "sort"
+
 type FunctionType int
 
 const (
 	NONE = FunctionType(iota)
 	FUNCTION
+	INITIALIZER
+	METHOD
 )
 
+type ClassType int
+
+const (
+	NO_CLASS = ClassType(iota)
+	IN_CLASS
+	IN_SUBCLASS
+)
+
+// Resolver checks the static semantics of the program, and assigns each
+// reference to a local variable the environment slot of the variable.
 type Resolver struct {
-	interpreter     *Interpreter
-	scopes          []map[string]bool
+	scopes          []map[string]*localVariable
 	currentFunction FunctionType
+	currentClass    ClassType
+	loopDepth       int
+	diagnostics     Diagnostics
+
+	// analysis, if set, collects the symbols declared and referenced in the
+	// code.
+	analysis *Analysis
 }
 
-func NewResolver(i *Interpreter) *Resolver {
+// localVariable is a variable declared in a local scope.
+type localVariable struct {
+	slot    int
+	defined bool
+	used    bool
+	symbol  *Symbol
+	// declaration is the name in the var statement that declared the
+	// variable, if any. Such variables are reported if they are never used.
+	declaration *Token
+}
+
+func NewResolver() *Resolver {
 	return &Resolver{
-		interpreter:     i,
 		scopes:          nil,
 		currentFunction: NONE,
+		currentClass:    NO_CLASS,
 	}
 }
 
 func (r *Resolver) visitAssignExpr(a *Assign) interface{} {
 	r.resolveExpr(a.value)
-	r.resolveLocal(a, a.name)
+	r.addReference(a.name)
+	a.local = r.resolveLocal(a.name)
 	return nil
 }
 
@@ -41,11 +73,34 @@ func (r *Resolver) visitCallExpr(c *Call) interface{} {
 	return nil
 }
 
+func (r *Resolver) visitGetExpr(g *Get) interface{} {
+	r.resolveExpr(g.object)
+	return nil
+}
+
 func (r *Resolver) visitGroupingExpr(g *Grouping) interface{} {
 	r.resolveExpr(g.expression)
 	return nil
 }
 
+func (r *Resolver) visitIndexExpr(i *Index) interface{} {
+	r.resolveExpr(i.object)
+	r.resolveExpr(i.index)
+	return nil
+}
+
+func (r *Resolver) visitLambdaExpr(l *Lambda) interface{} {
+	r.resolveFunction(l.declaration, FUNCTION)
+	return nil
+}
+
+func (r *Resolver) visitListExpr(l *List) interface{} {
+	for _, element := range l.elements {
+		r.resolveExpr(element)
+	}
+	return nil
+}
+
 func (r *Resolver) visitLiteralExpr(l *Literal) interface{} {
 	return nil
 }
@@ -56,6 +111,48 @@ func (r *Resolver) visitLogicalExpr(l *Logical) interface{} {
 	return nil
 }
 
+func (r *Resolver) visitMapExpr(m *Map) interface{} {
+	for k := range m.keys {
+		r.resolveExpr(m.keys[k])
+		r.resolveExpr(m.values[k])
+	}
+	return nil
+}
+
+func (r *Resolver) visitSetExpr(s *Set) interface{} {
+	r.resolveExpr(s.value)
+	r.resolveExpr(s.object)
+	return nil
+}
+
+func (r *Resolver) visitSetIndexExpr(s *SetIndex) interface{} {
+	r.resolveExpr(s.value)
+	r.resolveExpr(s.object)
+	r.resolveExpr(s.index)
+	return nil
+}
+
+func (r *Resolver) visitSuperExpr(s *Super) interface{} {
+	if r.currentClass == NO_CLASS {
+		r.diagnostics.errorAt(s.keyword, "Can't use 'super' outside of a class.")
+		return nil
+	} else if r.currentClass != IN_SUBCLASS {
+		r.diagnostics.errorAt(s.keyword, "Can't use 'super' in a class with no superclass.")
+		return nil
+	}
+	s.local = r.resolveLocal(s.keyword)
+	return nil
+}
+
+func (r *Resolver) visitThisExpr(t *This) interface{} {
+	if r.currentClass == NO_CLASS {
+		r.diagnostics.errorAt(t.keyword, "Can't use 'this' outside of a class.")
+		return nil
+	}
+	t.local = r.resolveLocal(t.keyword)
+	return nil
+}
+
 func (r *Resolver) visitUnaryExpr(u *Unary) interface{} {
 	r.resolveExpr(u.right)
 	return nil
@@ -63,21 +160,33 @@ func (r *Resolver) visitUnaryExpr(u *Unary) interface{} {
 
 func (r *Resolver) visitVariableExpr(v *Variable) interface{} {
 	if len(r.scopes) > 0 {
-		if defined, ok := r.scopes[len(r.scopes)-1][v.name.lexeme]; ok && !defined {
-			ReportTokenError(v.name, "Can't read local variable in its own initializer.")
+		if variable, ok := r.scopes[len(r.scopes)-1][v.name.lexeme]; ok && !variable.defined {
+			r.diagnostics.errorAt(v.name, "Can't read local variable in its own initializer.")
 		}
 	}
-	r.resolveLocal(v, v.name)
+	r.addReference(v.name)
+	v.local = r.resolveLocal(v.name)
 	return nil
 }
 
-func (r *Resolver) resolveLocal(expr Expr, name *Token) {
+// resolveLocal returns the location of the local variable with the given
+// name, or nil if it is a global variable.
+func (r *Resolver) resolveLocal(name *Token) *localSlot {
 	for i := len(r.scopes) - 1; i >= 0; i-- {
-		if _, ok := r.scopes[i][name.lexeme]; ok {
-			r.interpreter.resolve(expr, len(r.scopes)-1-i)
-			return
+		if variable, ok := r.scopes[i][name.lexeme]; ok {
+			variable.used = true
+			return &localSlot{depth: len(r.scopes) - 1 - i, slot: variable.slot}
 		}
 	}
+	return nil
+}
+
+func (r *Resolver) visitAssertStmt(a *Assert) interface{} {
+	r.resolveExpr(a.condition)
+	if a.message != nil {
+		r.resolveExpr(a.message)
+	}
+	return nil
 }
 
 func (r *Resolver) visitBlockStmt(b *Block) interface{} {
@@ -87,8 +196,70 @@ func (r *Resolver) visitBlockStmt(b *Block) interface{} {
 	return nil
 }
 
-func (r *Resolver) Resolve(statements []Stmt) {
+func (r *Resolver) visitClassStmt(c *Class) interface{} {
+	enclosingClass := r.currentClass
+	r.currentClass = IN_CLASS
+
+	r.declare(c.name)
+	r.define(c.name)
+	var params []*Token
+	for _, method := range c.methods {
+		if method.name.lexeme == "init" {
+			params = method.params
+		}
+	}
+	r.addSymbol(c.name, ClassSymbol, params)
+
+	if c.superclass != nil {
+		if c.name.lexeme == c.superclass.name.lexeme {
+			r.diagnostics.errorAt(c.superclass.name, "A class can't inherit from itself.")
+		}
+
+		r.currentClass = IN_SUBCLASS
+		r.resolveExpr(c.superclass)
+
+		r.beginScope()
+		r.defineImplicit("super")
+	}
+
+	r.beginScope()
+	r.defineImplicit("this")
+
+	for _, method := range c.methods {
+		declaration := METHOD
+		if method.name.lexeme == "init" {
+			declaration = INITIALIZER
+		}
+		r.resolveFunction(method, declaration)
+	}
+
+	r.endScope()
+
+	if c.superclass != nil {
+		r.endScope()
+	}
+
+	r.currentClass = enclosingClass
+	return nil
+}
+
+func (r *Resolver) visitBreakStmt(b *Break) interface{} {
+	if r.loopDepth == 0 {
+		r.diagnostics.errorAt(b.keyword, "Can't use 'break' outside of a loop.")
+	}
+	return nil
+}
+
+func (r *Resolver) visitContinueStmt(c *Continue) interface{} {
+	if r.loopDepth == 0 {
+		r.diagnostics.errorAt(c.keyword, "Can't use 'continue' outside of a loop.")
+	}
+	return nil
+}
+
+func (r *Resolver) Resolve(statements []Stmt) Diagnostics {
 	r.resolveStmts(statements)
+	return r.diagnostics
 }
 
 func (r *Resolver) resolveStmts(statements []Stmt) {
@@ -98,6 +269,10 @@ func (r *Resolver) resolveStmts(statements []Stmt) {
 }
 
 func (r *Resolver) resolveStmt(stmt Stmt) {
+	if stmt == nil {
+		// A statement with a syntax error.
+		return
+	}
 	stmt.accept(r)
 }
 
@@ -106,10 +281,20 @@ func (r *Resolver) resolveExpr(e Expr) {
 }
 
 func (r *Resolver) beginScope() {
-	r.scopes = append(r.scopes, make(map[string]bool))
+	r.scopes = append(r.scopes, make(map[string]*localVariable))
 }
 
 func (r *Resolver) endScope() {
+	var unused []*localVariable
+	for _, variable := range r.scopes[len(r.scopes)-1] {
+		if variable.declaration != nil && !variable.used {
+			unused = append(unused, variable)
+		}
+	}
+	sort.Slice(unused, func(i, j int) bool { return unused[i].slot < unused[j].slot })
+	for _, variable := range unused {
+		r.diagnostics.warningAt(variable.declaration, "Local variable '"+variable.declaration.lexeme+"' is never used.")
+	}
 	r.scopes = r.scopes[:len(r.scopes)-1]
 }
 
@@ -121,6 +306,7 @@ func (r *Resolver) visitExpressionStmt(e *Expression) interface{} {
 func (r *Resolver) visitFunctionStmt(f *Function) interface{} {
 	r.declare(f.name)
 	r.define(f.name)
+	r.addSymbol(f.name, FunctionSymbol, f.params)
 	r.resolveFunction(f, FUNCTION)
 	return nil
 }
@@ -128,16 +314,20 @@ func (r *Resolver) visitFunctionStmt(f *Function) interface{} {
 func (r *Resolver) resolveFunction(function *Function, kind FunctionType) {
 	enclosingFunction := r.currentFunction
 	r.currentFunction = kind
+	enclosingLoopDepth := r.loopDepth
+	r.loopDepth = 0
 
 	r.beginScope()
 	for _, param := range function.params {
 		r.declare(param)
 		r.define(param)
+		r.addSymbol(param, ParameterSymbol, nil)
 	}
 	r.resolveStmts(function.body)
 	r.endScope()
 
 	r.currentFunction = enclosingFunction
+	r.loopDepth = enclosingLoopDepth
 }
 
 func (r *Resolver) visitIfStmt(i *If) interface{} {
@@ -149,6 +339,20 @@ func (r *Resolver) visitIfStmt(i *If) interface{} {
 	return nil
 }
 
+func (r *Resolver) visitImportStmt(i *Import) interface{} {
+	if i.name != nil {
+		r.declare(i.name)
+		r.define(i.name)
+		r.addSymbol(i.name, ImportSymbol, nil)
+	}
+	for _, name := range i.names {
+		r.declare(name)
+		r.define(name)
+		r.addSymbol(name, ImportSymbol, nil)
+	}
+	return nil
+}
+
 func (r *Resolver) visitPrintStmt(p *Print) interface{} {
 	r.resolveExpr(p.expression)
 	return nil
@@ -156,24 +360,51 @@ func (r *Resolver) visitPrintStmt(p *Print) interface{} {
 
 func (r *Resolver) visitReturnStmt(ret *Return) interface{} {
 	if r.currentFunction == NONE {
-		ReportTokenError(ret.keyword, "Can't return from top-level code.")
+		r.diagnostics.errorAt(ret.keyword, "Can't return from top-level code.")
 	}
 
 	if ret.value != nil {
+		if r.currentFunction == INITIALIZER {
+			r.diagnostics.errorAt(ret.keyword, "Can't return a value from an initializer.")
+		}
 		r.resolveExpr(ret.value)
 	}
 	return nil
 }
 
+func (r *Resolver) visitThrowStmt(t *Throw) interface{} {
+	r.resolveExpr(t.value)
+	return nil
+}
+
+func (r *Resolver) visitTryStmt(t *Try) interface{} {
+	r.resolveStmt(t.body)
+
+	if t.catchBody != nil {
+		r.beginScope()
+		r.declare(t.catchName)
+		r.define(t.catchName)
+		r.addSymbol(t.catchName, ParameterSymbol, nil)
+		r.resolveStmt(t.catchBody)
+		r.endScope()
+	}
+
+	if t.finallyBody != nil {
+		r.resolveStmt(t.finallyBody)
+	}
+	return nil
+}
+
 func (r *Resolver) declare(name *Token) {
 	if len(r.scopes) == 0 {
 		return
 	}
 	scope := r.scopes[len(r.scopes)-1]
 	if _, ok := scope[name.lexeme]; ok {
-		ReportTokenError(name, "Already variable with this name in this scope.")
+		r.diagnostics.errorAt(name, "Already variable with this name in this scope.")
+		return
 	}
-	scope[name.lexeme] = false
+	scope[name.lexeme] = &localVariable{slot: len(scope)}
 }
 
 func (r *Resolver) define(name *Token) {
@@ -181,11 +412,22 @@ func (r *Resolver) define(name *Token) {
 		return
 	}
 	scope := r.scopes[len(r.scopes)-1]
-	scope[name.lexeme] = true
+	scope[name.lexeme].defined = true
+}
+
+// defineImplicit declares and defines a variable that is not declared in the
+// code, such as "this".
+func (r *Resolver) defineImplicit(name string) {
+	scope := r.scopes[len(r.scopes)-1]
+	scope[name] = &localVariable{slot: len(scope), defined: true}
 }
 
 func (r *Resolver) visitVarStmt(v *Var) interface{} {
 	r.declare(v.name)
+	if len(r.scopes) > 0 {
+		r.scopes[len(r.scopes)-1][v.name.lexeme].declaration = v.name
+	}
+	r.addSymbol(v.name, VariableSymbol, nil)
 	if v.initializer != nil {
 		r.resolveExpr(v.initializer)
 	}
@@ -195,6 +437,11 @@ func (r *Resolver) visitVarStmt(v *Var) interface{} {
 
 func (r *Resolver) visitWhileStmt(w *While) interface{} {
 	r.resolveExpr(w.condition)
+	r.loopDepth++
 	r.resolveStmt(w.body)
+	r.loopDepth--
+	if w.increment != nil {
+		r.resolveExpr(w.increment)
+	}
 	return nil
 }
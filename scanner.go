@@ -1,53 +1,135 @@
 package lox
 
-import "strconv"
+import (
+	"strconv"
+	"unicode/utf8"
+)
 
 var keywords = map[string]TokenType{
-	"and":    AND,
-	"class":  CLASS,
-	"else":   ELSE,
-	"false":  FALSE,
-	"for":    FOR,
-	"fun":    FUN,
-	"if":     IF,
-	"nil":    NIL,
-	"or":     OR,
-	"print":  PRINT,
-	"return": RETURN,
-	"super":  SUPER,
-	"this":   THIS,
-	"true":   TRUE,
-	"var":    VAR,
-	"while":  WHILE,
+	"and":      AND,
+	"assert":   ASSERT,
+	"break":    BREAK,
+	"catch":    CATCH,
+	"class":    CLASS,
+	"continue": CONTINUE,
+	"else":     ELSE,
+	"false":    FALSE,
+	"finally":  FINALLY,
+	"for":      FOR,
+	"fun":      FUN,
+	"if":       IF,
+	"import":   IMPORT,
+	"nil":      NIL,
+	"or":       OR,
+	"print":    PRINT,
+	"return":   RETURN,
+	"super":    SUPER,
+	"this":     THIS,
+	"throw":    THROW,
+	"true":     TRUE,
+	"try":      TRY,
+	"var":      VAR,
+	"while":    WHILE,
 }
 
 type Scanner struct {
-	source string
-	tokens []*Token
+	source      string
+	file        *Source
+	tokens      []*Token
+	comments    []*Token
+	diagnostics Diagnostics
 
 	start   int
 	current int
 	line    int
+
+	// lineStart is the offset of the first character of the current line.
+	lineStart int
+	// startLine and startColumn are the position of the current lexeme.
+	startLine   int
+	startColumn int
 }
 
 func NewScanner(source string) *Scanner {
+	return NewFileScanner("", source)
+}
+
+// NewFileScanner returns a Scanner for source code read from the given file.
+// The file name is recorded in the scanned tokens, for error reporting.
+func NewFileScanner(filename string, source string) *Scanner {
 	return &Scanner{
 		source:  source,
+		file:    &Source{Name: filename, Text: source},
 		start:   0,
 		current: 0,
 		line:    1,
 	}
 }
 
-func (s *Scanner) ScanTokens() []*Token {
+func (s *Scanner) ScanTokens() ([]*Token, Diagnostics) {
 	for !s.isAtEnd() {
 		// We are at the beginning of the next lexeme.
-		s.start = s.current
+		s.beginLexeme()
 		s.scanToken()
 	}
 
-	s.tokens = append(s.tokens, NewToken(EOF, "", nil, s.line))
-	return s.tokens
+	s.beginLexeme()
+	s.addToken(EOF, nil)
+	return s.tokens, s.diagnostics
+}
+
+// Incomplete reports whether the source code ends inside a string or an
+// unclosed bracket, so that an interactive prompt should read more lines
+// before running it.
+func Incomplete(source string) bool {
+	tokens, diagnostics := NewScanner(source).ScanTokens()
+	for _, d := range diagnostics {
+		if d.Message == "Unterminated string." {
+			return true
+		}
+	}
+	depth := 0
+	for _, token := range tokens {
+		switch token.kind {
+		case LEFT_PAREN, LEFT_BRACKET, LEFT_BRACE:
+			depth++
+		case RIGHT_PAREN, RIGHT_BRACKET, RIGHT_BRACE:
+			depth--
+		}
+	}
+	return depth > 0
+}
+
+// Comments returns the comments found by ScanTokens, as COMMENT tokens
+// whose lexeme includes the leading "//".
+func (s *Scanner) Comments() []*Token {
+	return s.comments
+}
+
+func (s *Scanner) beginLexeme() {
+	s.start = s.current
+	s.startLine = s.line
+	s.startColumn = utf8.RuneCountInString(s.source[s.lineStart:s.start]) + 1
+}
+
+func (s *Scanner) error(message string) {
+	s.diagnostics.add(&Diagnostic{
+		Severity: SeverityError,
+		Message:  message,
+		Position: s.position(),
+		source:   s.file,
+	})
+}
+
+// position returns the position of the current lexeme.
+func (s *Scanner) position() Position {
+	return Position{
+		Filename: s.file.Name,
+		Line:     s.startLine,
+		Column:   s.startColumn,
+		Offset:   s.start,
+		End:      s.current,
+	}
 }
 
 func (s *Scanner) isAtEnd() bool {
@@ -65,6 +147,12 @@ func (s *Scanner) scanToken() {
 		s.addToken(LEFT_BRACE, nil)
 	case '}':
 		s.addToken(RIGHT_BRACE, nil)
+	case '[':
+		s.addToken(LEFT_BRACKET, nil)
+	case ']':
+		s.addToken(RIGHT_BRACKET, nil)
+	case ':':
+		s.addToken(COLON, nil)
 	case ',':
 		s.addToken(COMMA, nil)
 	case '.':
@@ -107,6 +195,7 @@ func (s *Scanner) scanToken() {
 			for s.peek() != '\n' && !s.isAtEnd() {
 				s.advance()
 			}
+			s.comments = append(s.comments, s.newToken(COMMENT, nil))
 		} else {
 			s.addToken(SLASH, nil)
 		}
@@ -119,7 +208,7 @@ func (s *Scanner) scanToken() {
 	case '\t': // Ignore whitespace.
 
 	case '\n':
-		s.line++
+		s.newline()
 
 	default:
 		if isDigit(c) {
@@ -127,7 +216,7 @@ func (s *Scanner) scanToken() {
 		} else if isAlpha(c) {
 			s.identifier()
 		} else {
-			ReportError(s.line, "Unexpected character.")
+			s.error("Unexpected character.")
 		}
 	}
 }
@@ -146,6 +235,21 @@ func isAlphaNumeric(c byte) bool {
 	return isAlpha(c) || isDigit(c)
 }
 
+// isIdentifier reports whether text would be scanned as a single IDENTIFIER
+// token.
+func isIdentifier(text string) bool {
+	if text == "" || !isAlpha(text[0]) {
+		return false
+	}
+	for i := 1; i < len(text); i++ {
+		if !isAlphaNumeric(text[i]) {
+			return false
+		}
+	}
+	_, isKeyword := keywords[text]
+	return !isKeyword
+}
+
 func (s *Scanner) identifier() {
 	for isAlphaNumeric(s.peek()) {
 		s.advance()
@@ -174,7 +278,7 @@ func (s *Scanner) numberToken() {
 	}
 	n, err := strconv.ParseFloat(s.source[s.start:s.current], 64)
 	if err != nil {
-		ReportError(s.line, err.Error())
+		s.error(err.Error())
 	} else {
 		s.addToken(NUMBER, n)
 	}
@@ -182,14 +286,14 @@ func (s *Scanner) numberToken() {
 
 func (s *Scanner) stringToken() {
 	for s.peek() != '"' && !s.isAtEnd() {
-		if s.peek() == '\n' {
-			s.line++
-		}
 		s.advance()
+		if s.previous() == '\n' {
+			s.newline()
+		}
 	}
 
 	if s.isAtEnd() {
-		ReportError(s.line, "Unterminated string.")
+		s.error("Unterminated string.")
 		return
 	}
 
@@ -233,7 +337,30 @@ func (s *Scanner) advance() byte {
 	return c
 }
 
+func (s *Scanner) previous() byte {
+	return s.source[s.current-1]
+}
+
+// newline must be called after consuming a '\n' character.
+func (s *Scanner) newline() {
+	s.line++
+	s.lineStart = s.current
+}
+
 func (s *Scanner) addToken(kind TokenType, literal interface{}) {
+	s.tokens = append(s.tokens, s.newToken(kind, literal))
+}
+
+func (s *Scanner) newToken(kind TokenType, literal interface{}) *Token {
 	text := s.source[s.start:s.current]
-	s.tokens = append(s.tokens, NewToken(kind, text, literal, s.line))
+	return &Token{
+		kind:    kind,
+		lexeme:  text,
+		literal: literal,
+		line:    s.startLine,
+		column:  s.startColumn,
+		offset:  s.start,
+		end:     s.current,
+		source:  s.file,
+	}
 }
@@ -0,0 +1,22 @@
+package lox
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIncomplete(t *testing.T) {
+	for source, incomplete := range map[string]bool{
+		"print 1;":                       false,
+		"fun f() {":                      true,
+		"fun f() {\n  print (1 +\n":      true,
+		"fun f() {\n  print \"}\";\n}":   false,
+		"var s = \"unterminated\n":       true,
+		"var l = [1, // ]\n":             true,
+		"print 1);":                      false,
+		"class A { m() { return {}; } }": false,
+	} {
+		require.Equal(t, incomplete, Incomplete(source), source)
+	}
+}
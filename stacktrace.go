@@ -0,0 +1,101 @@
+package lox
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StackFrame is an entry of the stack trace of a RuntimeError.
+type StackFrame struct {
+	// Function is the name of the function, or "script" for top-level code.
+	Function string
+	// Position is the location that was being executed in the function.
+	Position Position
+}
+
+func (f StackFrame) String() string {
+	where := "in " + f.Function + "()"
+	if f.Function == "script" {
+		where = "in script"
+	}
+	if f.Position.Line == 0 {
+		// The position is not known.
+		return where
+	}
+	return f.Position.String() + " " + where
+}
+
+// callFrame records an active call, to build stack traces.
+type callFrame struct {
+	function string
+	call     *Token
+	// environment is the one of the caller, for the Debugger.
+	environment *Environment
+}
+
+// stackTrace builds the stack trace for an error raised at the given token
+// (which may be nil), from the innermost call frame outwards.
+func (i *Interpreter) stackTrace(token *Token) []StackFrame {
+	trace := make([]StackFrame, 0, len(i.frames)+1)
+	var position Position
+	if token != nil {
+		position = token.Position()
+	}
+	for k := len(i.frames) - 1; k >= 0; k-- {
+		trace = append(trace, StackFrame{i.frames[k].function, position})
+		position = i.frames[k].call.Position()
+	}
+	return append(trace, StackFrame{"script", position})
+}
+
+// callToken returns the token of the innermost active call, which is where
+// errors raised by native functions are reported. It returns nil if the
+// native function was called by the host instead of Lox code.
+func (i *Interpreter) callToken() *Token {
+	if len(i.frames) == 0 {
+		return nil
+	}
+	return i.frames[len(i.frames)-1].call
+}
+
+func callableName(callable LoxCallable) string {
+	switch callable := callable.(type) {
+	case *LoxFunction:
+		if callable.declaration.name == nil {
+			return "<anonymous>"
+		}
+		return callable.declaration.name.lexeme
+	case *LoxClass:
+		return callable.name
+	case *nativeMethod:
+		return callable.name.lexeme
+	case *nativeFunction:
+		return callable.name
+	case Clock:
+		return "clock"
+	}
+	return "<native>"
+}
+
+// maxRepeatedFrames is the number of identical consecutive frames that are
+// printed before collapsing the rest, e.g. in infinite recursion.
+const maxRepeatedFrames = 3
+
+func renderStackTrace(trace []StackFrame) string {
+	var b strings.Builder
+	b.WriteString("Traceback (most recent call first):\n")
+	for k := 0; k < len(trace); {
+		n := 1
+		for k+n < len(trace) && trace[k+n] == trace[k] {
+			n++
+		}
+		for j := 0; j < n && j < maxRepeatedFrames; j++ {
+			b.WriteString("  " + trace[k].String() + "\n")
+		}
+		if n > maxRepeatedFrames {
+			fmt.Fprintf(&b, "  [Previous frame repeated %d more times]\n", n-maxRepeatedFrames)
+		}
+		k += n
+	}
+	return b.String()
+}
@@ -6,6 +6,26 @@ type Stmt interface {
 	accept(v StmtVisitor) interface{}
 }
 
+type Assert struct {
+	keyword   *Token
+	condition Expr
+	message   Expr
+	text      string
+}
+
+func NewAssert(keyword *Token, condition Expr, message Expr, text string) *Assert {
+	return &Assert{
+		keyword:   keyword,
+		condition: condition,
+		message:   message,
+		text:      text,
+	}
+}
+
+func (a *Assert) accept(sv StmtVisitor) interface{} {
+	return sv.visitAssertStmt(a)
+}
+
 type Block struct {
 	statements []Stmt
 }
@@ -20,6 +40,52 @@ func (b *Block) accept(sv StmtVisitor) interface{} {
 	return sv.visitBlockStmt(b)
 }
 
+type Break struct {
+	keyword *Token
+}
+
+func NewBreak(keyword *Token) *Break {
+	return &Break{
+		keyword: keyword,
+	}
+}
+
+func (b *Break) accept(sv StmtVisitor) interface{} {
+	return sv.visitBreakStmt(b)
+}
+
+type Class struct {
+	name       *Token
+	superclass *Variable
+	methods    []*Function
+}
+
+func NewClass(name *Token, superclass *Variable, methods []*Function) *Class {
+	return &Class{
+		name:       name,
+		superclass: superclass,
+		methods:    methods,
+	}
+}
+
+func (c *Class) accept(sv StmtVisitor) interface{} {
+	return sv.visitClassStmt(c)
+}
+
+type Continue struct {
+	keyword *Token
+}
+
+func NewContinue(keyword *Token) *Continue {
+	return &Continue{
+		keyword: keyword,
+	}
+}
+
+func (c *Continue) accept(sv StmtVisitor) interface{} {
+	return sv.visitContinueStmt(c)
+}
+
 type Expression struct {
 	expression Expr
 }
@@ -53,13 +119,15 @@ func (f *Function) accept(sv StmtVisitor) interface{} {
 }
 
 type If struct {
+	keyword    *Token
 	condition  Expr
 	thenBranch Stmt
 	elseBranch Stmt
 }
 
-func NewIf(condition Expr, thenBranch Stmt, elseBranch Stmt) *If {
+func NewIf(keyword *Token, condition Expr, thenBranch Stmt, elseBranch Stmt) *If {
 	return &If{
+		keyword:    keyword,
 		condition:  condition,
 		thenBranch: thenBranch,
 		elseBranch: elseBranch,
@@ -70,12 +138,34 @@ func (i *If) accept(sv StmtVisitor) interface{} {
 	return sv.visitIfStmt(i)
 }
 
+type Import struct {
+	keyword *Token
+	path    *Token
+	name    *Token
+	names   []*Token
+}
+
+func NewImport(keyword *Token, path *Token, name *Token, names []*Token) *Import {
+	return &Import{
+		keyword: keyword,
+		path:    path,
+		name:    name,
+		names:   names,
+	}
+}
+
+func (i *Import) accept(sv StmtVisitor) interface{} {
+	return sv.visitImportStmt(i)
+}
+
 type Print struct {
+	keyword    *Token
 	expression Expr
 }
 
-func NewPrint(expression Expr) *Print {
+func NewPrint(keyword *Token, expression Expr) *Print {
 	return &Print{
+		keyword:    keyword,
 		expression: expression,
 	}
 }
@@ -100,6 +190,44 @@ func (r *Return) accept(sv StmtVisitor) interface{} {
 	return sv.visitReturnStmt(r)
 }
 
+type Throw struct {
+	keyword *Token
+	value   Expr
+}
+
+func NewThrow(keyword *Token, value Expr) *Throw {
+	return &Throw{
+		keyword: keyword,
+		value:   value,
+	}
+}
+
+func (t *Throw) accept(sv StmtVisitor) interface{} {
+	return sv.visitThrowStmt(t)
+}
+
+type Try struct {
+	keyword     *Token
+	body        *Block
+	catchName   *Token
+	catchBody   *Block
+	finallyBody *Block
+}
+
+func NewTry(keyword *Token, body *Block, catchName *Token, catchBody *Block, finallyBody *Block) *Try {
+	return &Try{
+		keyword:     keyword,
+		body:        body,
+		catchName:   catchName,
+		catchBody:   catchBody,
+		finallyBody: finallyBody,
+	}
+}
+
+func (t *Try) accept(sv StmtVisitor) interface{} {
+	return sv.visitTryStmt(t)
+}
+
 type Var struct {
 	name        *Token
 	initializer Expr
@@ -117,14 +245,18 @@ func (v *Var) accept(sv StmtVisitor) interface{} {
 }
 
 type While struct {
+	keyword   *Token
 	condition Expr
 	body      Stmt
+	increment Expr
 }
 
-func NewWhile(condition Expr, body Stmt) *While {
+func NewWhile(keyword *Token, condition Expr, body Stmt, increment Expr) *While {
 	return &While{
+		keyword:   keyword,
 		condition: condition,
 		body:      body,
+		increment: increment,
 	}
 }
 
@@ -133,12 +265,19 @@ func (w *While) accept(sv StmtVisitor) interface{} {
 }
 
 type StmtVisitor interface {
+	visitAssertStmt(a *Assert) interface{}
 	visitBlockStmt(b *Block) interface{}
+	visitBreakStmt(b *Break) interface{}
+	visitClassStmt(c *Class) interface{}
+	visitContinueStmt(c *Continue) interface{}
 	visitExpressionStmt(e *Expression) interface{}
 	visitFunctionStmt(f *Function) interface{}
 	visitIfStmt(i *If) interface{}
+	visitImportStmt(i *Import) interface{}
 	visitPrintStmt(p *Print) interface{}
 	visitReturnStmt(r *Return) interface{}
+	visitThrowStmt(t *Throw) interface{}
+	visitTryStmt(t *Try) interface{}
 	visitVarStmt(v *Var) interface{}
 	visitWhileStmt(w *While) interface{}
 }
@@ -2,17 +2,61 @@ package lox
 
 import "fmt"
 
+// Source is a piece of source code, optionally read from a named file.
+type Source struct {
+	Name string
+	Text string
+}
+
 type Token struct {
 	kind    TokenType
 	lexeme  string
 	literal interface{}
 	line    int
+
+	// column is the 1-based position of the first character of the token in
+	// its line, counted in runes.
+	column int
+	// offset and end are the byte offsets of the token in the source code.
+	offset int
+	end    int
+	source *Source
 }
 
 func NewToken(kind TokenType, lexeme string, literal interface{}, line int) *Token {
-	return &Token{kind, lexeme, literal, line}
+	return &Token{kind: kind, lexeme: lexeme, literal: literal, line: line}
 }
 
 func (t *Token) String() string {
 	return fmt.Sprintf("%d %s %+v", t.kind, t.lexeme, t.literal)
 }
+
+func (t *Token) Lexeme() string { return t.lexeme }
+
+func (t *Token) Line() int { return t.line }
+
+func (t *Token) Column() int { return t.column }
+
+func (t *Token) Offset() int { return t.offset }
+
+func (t *Token) End() int { return t.end }
+
+// Filename returns the name of the file where the token was scanned, or ""
+// if it is not known.
+func (t *Token) Filename() string {
+	if t.source == nil {
+		return ""
+	}
+	return t.source.Name
+}
+
+// Position returns the location of the token in the source code.
+func (t *Token) Position() Position {
+	return Position{
+		Filename: t.Filename(),
+		Line:     t.line,
+		Column:   t.column,
+		Offset:   t.offset,
+		End:      t.end,
+	}
+}
@@ -0,0 +1,617 @@
+package lox
+
+import "fmt"
+
+// vmClosure is a function value of the virtual machine.
+type vmClosure struct {
+	function *vmFunction
+	upvalues []*vmUpvalue
+	// globals is the global environment of the module where the closure was
+	// created.
+	globals *Environment
+}
+
+func (c *vmClosure) String() string { return c.function.String() }
+
+// vmUpvalue is a variable captured by a closure. While the variable is still
+// on the stack the upvalue refers to its slot, and when the variable goes out
+// of scope its value is moved into the upvalue.
+type vmUpvalue struct {
+	slot   int
+	open   bool
+	closed interface{}
+}
+
+type vmClass struct {
+	name    string
+	methods map[string]*vmClosure
+}
+
+func (c *vmClass) String() string { return c.name }
+
+type vmInstance struct {
+	class  *vmClass
+	fields map[string]interface{}
+}
+
+func (i *vmInstance) String() string { return i.class.name + " instance" }
+
+type vmBoundMethod struct {
+	receiver interface{}
+	method   *vmClosure
+}
+
+func (m *vmBoundMethod) String() string { return m.method.String() }
+
+type vmFrame struct {
+	closure *vmClosure
+	ip      int
+	// base is the stack slot of the called function, where its slot zero
+	// starts.
+	base int
+	// name is reported in stack traces instead of the name of the function,
+	// e.g. the class of an initializer called by instantiating it.
+	name string
+}
+
+// vmHandler is an exception handler pushed by a try statement.
+type vmHandler struct {
+	frame    int
+	stackTop int
+	target   int
+	// natives is the depth of the interpreter's native call frames.
+	natives int
+}
+
+// vm executes the bytecode produced by the compiler.
+type vm struct {
+	interpreter  *Interpreter
+	stack        []interface{}
+	frames       []vmFrame
+	handlers     []vmHandler
+	openUpvalues []*vmUpvalue
+}
+
+func newVM(interpreter *Interpreter) *vm {
+	return &vm{interpreter: interpreter}
+}
+
+// interpret runs a compiled script with the given global environment and
+// returns the value it returns.
+func (vm *vm) interpret(function *vmFunction, globals *Environment) interface{} {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(RuntimeError); ok {
+				e.StackTrace = vm.stackTrace(e.Token)
+				r = e
+			}
+			vm.reset()
+			panic(r)
+		}
+	}()
+	return vm.callScript(function, globals)
+}
+
+// callScript runs a compiled script, such as an imported module, on top of
+// the current stack.
+func (vm *vm) callScript(function *vmFunction, globals *Environment) interface{} {
+	closure := &vmClosure{function: function, globals: globals}
+	base := len(vm.frames)
+	vm.push(closure)
+	vm.call(closure, 0)
+	vm.execute(base)
+	return vm.pop()
+}
+
+func (vm *vm) reset() {
+	vm.stack = vm.stack[:0]
+	vm.frames = vm.frames[:0]
+	vm.handlers = vm.handlers[:0]
+	vm.openUpvalues = vm.openUpvalues[:0]
+}
+
+func (vm *vm) push(value interface{}) {
+	vm.stack = append(vm.stack, value)
+}
+
+func (vm *vm) pop() interface{} {
+	value := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return value
+}
+
+func (vm *vm) peek(distance int) interface{} {
+	return vm.stack[len(vm.stack)-1-distance]
+}
+
+// token returns the token of the instruction being executed.
+func (vm *vm) token() *Token {
+	frame := &vm.frames[len(vm.frames)-1]
+	return frame.closure.function.chunk.tokenAt(frame.ip - 1)
+}
+
+func (vm *vm) runtimeError(message string) {
+	panic(NewRuntimeError(vm.token(), message))
+}
+
+// execute runs the frames above base until the function of the frame at base
+// returns, unwinding to the exception handlers pushed by those frames when an
+// error is raised.
+func (vm *vm) execute(base int) {
+	for !vm.tryExecute(base) {
+	}
+}
+
+func (vm *vm) tryExecute(base int) (done bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(RuntimeError); !ok || !vm.handle(e, base) {
+				panic(r)
+			}
+		}
+	}()
+	vm.run(base)
+	return true
+}
+
+// handle unwinds the stack to the innermost exception handler, and reports
+// whether there was one.
+func (vm *vm) handle(err RuntimeError, base int) bool {
+	if err.fatal || len(vm.handlers) == 0 {
+		return false
+	}
+	handler := vm.handlers[len(vm.handlers)-1]
+	if handler.frame < base {
+		return false
+	}
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+	vm.closeUpvalues(handler.stackTop)
+	vm.frames = vm.frames[:handler.frame+1]
+	vm.stack = vm.stack[:handler.stackTop]
+	vm.interpreter.frames = vm.interpreter.frames[:handler.natives]
+
+	vm.push(err)
+	vm.frames[handler.frame].ip = handler.target
+	return true
+}
+
+func (vm *vm) run(base int) {
+	i := vm.interpreter
+	frame := &vm.frames[len(vm.frames)-1]
+	chunk := &frame.closure.function.chunk
+
+	readByte := func() int {
+		b := chunk.code[frame.ip]
+		frame.ip++
+		return int(b)
+	}
+	readShort := func() int {
+		n := int(chunk.code[frame.ip])<<8 | int(chunk.code[frame.ip+1])
+		frame.ip += 2
+		return n
+	}
+	readConstant := func() interface{} {
+		return chunk.constants[readShort()]
+	}
+	readString := func() string {
+		return readConstant().(string)
+	}
+
+	for {
+		i.step()
+
+		switch op := OpCode(readByte()); op {
+		case OP_CONSTANT:
+			vm.push(readConstant())
+		case OP_NIL:
+			vm.push(nil)
+		case OP_TRUE:
+			vm.push(true)
+		case OP_FALSE:
+			vm.push(false)
+		case OP_POP:
+			vm.pop()
+		case OP_DUP:
+			vm.push(vm.peek(0))
+
+		case OP_GET_LOCAL:
+			vm.push(vm.stack[frame.base+readByte()])
+		case OP_SET_LOCAL:
+			vm.stack[frame.base+readByte()] = vm.peek(0)
+		case OP_GET_GLOBAL:
+			name := readString()
+			vm.push(frame.closure.globals.get(vm.nameToken(name)))
+		case OP_DEFINE_GLOBAL:
+			frame.closure.globals.define(readString(), vm.pop())
+		case OP_SET_GLOBAL:
+			name := readString()
+			frame.closure.globals.assign(vm.nameToken(name), vm.peek(0))
+		case OP_GET_UPVALUE:
+			upvalue := frame.closure.upvalues[readByte()]
+			if upvalue.open {
+				vm.push(vm.stack[upvalue.slot])
+			} else {
+				vm.push(upvalue.closed)
+			}
+		case OP_SET_UPVALUE:
+			upvalue := frame.closure.upvalues[readByte()]
+			if upvalue.open {
+				vm.stack[upvalue.slot] = vm.peek(0)
+			} else {
+				upvalue.closed = vm.peek(0)
+			}
+
+		case OP_GET_PROPERTY:
+			name := readString()
+			vm.stack[len(vm.stack)-1] = vm.getProperty(vm.peek(0), name)
+		case OP_SET_PROPERTY:
+			name := readString()
+			instance, ok := vm.peek(1).(*vmInstance)
+			if !ok {
+				vm.runtimeError("Only instances have fields.")
+			}
+			value := vm.pop()
+			instance.fields[name] = value
+			vm.stack[len(vm.stack)-1] = value
+		case OP_GET_SUPER:
+			name := readString()
+			superclass := vm.pop().(*vmClass)
+			method, ok := superclass.methods[name]
+			if !ok {
+				vm.runtimeError("Undefined property '" + name + "'.")
+			}
+			vm.stack[len(vm.stack)-1] = &vmBoundMethod{vm.peek(0), method}
+		case OP_GET_INDEX:
+			index := vm.pop()
+			switch object := vm.peek(0).(type) {
+			case *LoxList:
+				vm.stack[len(vm.stack)-1] = object.getIndex(vm.token(), index)
+			case *LoxMap:
+				vm.stack[len(vm.stack)-1] = object.getIndex(vm.token(), index)
+			default:
+				vm.runtimeError("Only lists and maps can be indexed.")
+			}
+		case OP_SET_INDEX:
+			value := vm.pop()
+			index := vm.pop()
+			switch object := vm.peek(0).(type) {
+			case *LoxList:
+				object.setIndex(vm.token(), index, value)
+			case *LoxMap:
+				object.setIndex(vm.token(), index, value)
+			default:
+				vm.runtimeError("Only lists and maps can be indexed.")
+			}
+			vm.stack[len(vm.stack)-1] = value
+
+		case OP_EQUAL:
+			b := vm.pop()
+			vm.stack[len(vm.stack)-1] = isEqual(vm.peek(0), b)
+		case OP_GREATER:
+			a, b := vm.popNumbers()
+			vm.push(a > b)
+		case OP_GREATER_EQUAL:
+			a, b := vm.popNumbers()
+			vm.push(a >= b)
+		case OP_LESS:
+			a, b := vm.popNumbers()
+			vm.push(a < b)
+		case OP_LESS_EQUAL:
+			a, b := vm.popNumbers()
+			vm.push(a <= b)
+		case OP_ADD:
+			switch a := vm.peek(1).(type) {
+			case float64:
+				if b, ok := vm.peek(0).(float64); ok {
+					vm.pop()
+					vm.stack[len(vm.stack)-1] = a + b
+					continue
+				}
+			case string:
+				if b, ok := vm.peek(0).(string); ok {
+					vm.pop()
+					vm.stack[len(vm.stack)-1] = a + b
+					continue
+				}
+			}
+			vm.runtimeError("Operands must be two numbers or two strings.")
+		case OP_SUBTRACT:
+			a, b := vm.popNumbers()
+			vm.push(a - b)
+		case OP_MULTIPLY:
+			a, b := vm.popNumbers()
+			vm.push(a * b)
+		case OP_DIVIDE:
+			a, b := vm.popNumbers()
+			vm.push(a / b)
+		case OP_NOT:
+			vm.stack[len(vm.stack)-1] = !isTruthy(vm.peek(0))
+		case OP_NEGATE:
+			vm.stack[len(vm.stack)-1] = -checkNumber(vm.token(), vm.peek(0))
+
+		case OP_PRINT:
+			fmt.Fprintf(i.stdout, "%s\n", stringify(vm.pop()))
+
+		case OP_JUMP:
+			offset := readShort()
+			frame.ip += offset
+		case OP_JUMP_IF_FALSE:
+			offset := readShort()
+			if !isTruthy(vm.peek(0)) {
+				frame.ip += offset
+			}
+		case OP_LOOP:
+			offset := readShort()
+			frame.ip -= offset
+
+		case OP_CALL:
+			argCount := readByte()
+			vm.callValue(vm.peek(argCount), argCount)
+			frame = &vm.frames[len(vm.frames)-1]
+			chunk = &frame.closure.function.chunk
+		case OP_CLOSURE:
+			function := readConstant().(*vmFunction)
+			closure := &vmClosure{
+				function: function,
+				upvalues: make([]*vmUpvalue, function.upvalueCount),
+				globals:  frame.closure.globals,
+			}
+			for k := range closure.upvalues {
+				isLocal := readByte()
+				index := readByte()
+				if isLocal == 1 {
+					closure.upvalues[k] = vm.captureUpvalue(frame.base + index)
+				} else {
+					closure.upvalues[k] = frame.closure.upvalues[index]
+				}
+			}
+			vm.push(closure)
+		case OP_CLOSE_UPVALUE:
+			vm.closeUpvalues(len(vm.stack) - 1)
+			vm.pop()
+		case OP_RETURN:
+			result := vm.pop()
+			vm.closeUpvalues(frame.base)
+			vm.stack = vm.stack[:frame.base]
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			vm.push(result)
+			if len(vm.frames) == base {
+				return
+			}
+			frame = &vm.frames[len(vm.frames)-1]
+			chunk = &frame.closure.function.chunk
+
+		case OP_CLASS:
+			vm.push(&vmClass{name: readString(), methods: make(map[string]*vmClosure)})
+		case OP_INHERIT:
+			superclass, ok := vm.peek(1).(*vmClass)
+			if !ok {
+				vm.runtimeError("Superclass must be a class.")
+			}
+			subclass := vm.pop().(*vmClass)
+			for name, method := range superclass.methods {
+				subclass.methods[name] = method
+			}
+		case OP_METHOD:
+			name := readString()
+			method := vm.pop().(*vmClosure)
+			vm.peek(0).(*vmClass).methods[name] = method
+
+		case OP_LIST:
+			n := readShort()
+			elements := make([]interface{}, n)
+			copy(elements, vm.stack[len(vm.stack)-n:])
+			vm.stack = vm.stack[:len(vm.stack)-n]
+			vm.push(NewLoxList(elements))
+		case OP_MAP:
+			n := readShort()
+			m := NewLoxMap()
+			entries := vm.stack[len(vm.stack)-2*n:]
+			for k := 0; k < len(entries); k += 2 {
+				m.setIndex(vm.token(), entries[k], entries[k+1])
+			}
+			vm.stack = vm.stack[:len(vm.stack)-2*n]
+			vm.push(m)
+
+		case OP_THROW:
+			panic(newThrowError(vm.token(), vm.pop()))
+		case OP_ASSERTION_FAILED:
+			text := readString()
+			panic(newAssertionError(vm.token(), text, vm.pop()))
+		case OP_RETHROW:
+			panic(vm.pop().(RuntimeError))
+		case OP_PUSH_HANDLER:
+			offset := readShort()
+			vm.handlers = append(vm.handlers, vmHandler{
+				frame:    len(vm.frames) - 1,
+				stackTop: len(vm.stack),
+				target:   frame.ip + offset,
+				natives:  len(i.frames),
+			})
+		case OP_POP_HANDLER:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case OP_ERROR_VALUE:
+			vm.stack[len(vm.stack)-1] = vm.peek(0).(RuntimeError).Value
+
+		case OP_IMPORT:
+			path := readConstant().(*Token)
+			vm.push(i.importModule(path))
+			// Importing may have grown the stacks.
+			frame = &vm.frames[len(vm.frames)-1]
+			chunk = &frame.closure.function.chunk
+		case OP_IMPORT_NAME:
+			path := readConstant().(*Token)
+			name := readConstant().(*Token)
+			module := i.importModule(path)
+			vm.push(module.get(name))
+			frame = &vm.frames[len(vm.frames)-1]
+			chunk = &frame.closure.function.chunk
+
+		default:
+			panic(fmt.Sprintf("unknown opcode %d", op))
+		}
+	}
+}
+
+// nameToken returns a token for the given name at the position of the
+// instruction being executed, to report undefined variables.
+func (vm *vm) nameToken(name string) *Token {
+	token := vm.token()
+	if token == nil || token.lexeme != name {
+		return &Token{kind: IDENTIFIER, lexeme: name}
+	}
+	return token
+}
+
+func (vm *vm) popNumbers() (float64, float64) {
+	b := vm.pop()
+	a := vm.pop()
+	return checkNumbers(vm.token(), a, b)
+}
+
+func (vm *vm) getProperty(object interface{}, name string) interface{} {
+	switch object := object.(type) {
+	case *vmInstance:
+		if value, ok := object.fields[name]; ok {
+			return value
+		}
+		if method, ok := object.class.methods[name]; ok {
+			return &vmBoundMethod{object, method}
+		}
+		vm.runtimeError("Undefined property '" + name + "'.")
+	case *LoxList:
+		return object.get(vm.token())
+	case *LoxMap:
+		return object.get(vm.token())
+	case *LoxError:
+		return object.get(vm.token())
+	case *LoxModule:
+		return object.get(vm.token())
+	}
+	vm.runtimeError("Only instances have properties.")
+	return nil
+}
+
+// callValue calls the value below the arguments on top of the stack. Calls to
+// Lox functions push a new frame, while native functions are called right
+// away, leaving their result on the stack.
+func (vm *vm) callValue(callee interface{}, argCount int) {
+	switch callee := callee.(type) {
+	case *vmClosure:
+		vm.call(callee, argCount)
+		return
+	case *vmBoundMethod:
+		vm.stack[len(vm.stack)-argCount-1] = callee.receiver
+		vm.call(callee.method, argCount)
+		return
+	case *vmClass:
+		vm.stack[len(vm.stack)-argCount-1] = &vmInstance{callee, make(map[string]interface{})}
+		if initializer, ok := callee.methods["init"]; ok {
+			vm.call(initializer, argCount)
+			vm.frames[len(vm.frames)-1].name = callee.name
+		} else if argCount != 0 {
+			vm.runtimeError(fmt.Sprintf("Expected 0 arguments but got %d.", argCount))
+		}
+		return
+	case LoxCallable:
+		if arity := callee.Arity(); arity >= 0 && argCount != arity {
+			vm.runtimeError(fmt.Sprintf("Expected %d arguments but got %d.", arity, argCount))
+		}
+		i := vm.interpreter
+		arguments := make([]interface{}, argCount)
+		copy(arguments, vm.stack[len(vm.stack)-argCount:])
+		i.frames = append(i.frames, callFrame{callableName(callee), vm.token(), nil})
+		result := callee.Call(i, arguments)
+		i.frames = i.frames[:len(i.frames)-1]
+		vm.stack = vm.stack[:len(vm.stack)-argCount]
+		vm.stack[len(vm.stack)-1] = result
+		return
+	}
+	vm.runtimeError("Can only call functions and classes.")
+}
+
+func (vm *vm) call(closure *vmClosure, argCount int) {
+	if argCount != closure.function.arity {
+		vm.runtimeError(fmt.Sprintf("Expected %d arguments but got %d.", closure.function.arity, argCount))
+	}
+	// The first frame is the script's, which is not counted as a call, the
+	// same as in Interpreter.visitCallExpr.
+	if max := vm.interpreter.maxCallDepth; max > 0 && len(vm.frames)-1 >= max {
+		vm.runtimeError("Stack overflow.")
+	}
+	vm.frames = append(vm.frames, vmFrame{
+		closure: closure,
+		base:    len(vm.stack) - argCount - 1,
+	})
+}
+
+func (vm *vm) captureUpvalue(slot int) *vmUpvalue {
+	for _, upvalue := range vm.openUpvalues {
+		if upvalue.slot == slot {
+			return upvalue
+		}
+	}
+	upvalue := &vmUpvalue{slot: slot, open: true}
+	vm.openUpvalues = append(vm.openUpvalues, upvalue)
+	return upvalue
+}
+
+// closeUpvalues closes the open upvalues of the stack slots from the given
+// one upwards.
+func (vm *vm) closeUpvalues(slot int) {
+	open := vm.openUpvalues[:0]
+	for _, upvalue := range vm.openUpvalues {
+		if upvalue.slot >= slot {
+			upvalue.closed = vm.stack[upvalue.slot]
+			upvalue.open = false
+		} else {
+			open = append(open, upvalue)
+		}
+	}
+	vm.openUpvalues = open
+}
+
+// stackTrace builds the stack trace for an error raised at the given token
+// (which may be nil), from the innermost frame outwards.
+func (vm *vm) stackTrace(token *Token) []StackFrame {
+	var trace []StackFrame
+	var position Position
+	if token != nil {
+		position = token.Position()
+	}
+
+	// Native functions are the innermost frames.
+	natives := vm.interpreter.frames
+	for k := len(natives) - 1; k >= 0; k-- {
+		trace = append(trace, StackFrame{natives[k].function, position})
+		position = natives[k].call.Position()
+	}
+
+	inModule := false
+	for k := len(vm.frames) - 1; k >= 0; k-- {
+		frame := vm.frames[k]
+		if k < len(vm.frames)-1 && !inModule {
+			if token := frame.closure.function.chunk.tokenAt(frame.ip - 1); token != nil {
+				position = token.Position()
+			}
+		}
+		// The top-level code of an imported module is not a call, as in the
+		// tree-walker: its position is reported in the importer's frame.
+		inModule = frame.closure.function.isScript && k > 0
+		if inModule {
+			continue
+		}
+		name := frame.name
+		if name == "" {
+			name = frame.closure.function.name
+		}
+		if frame.closure.function.isScript {
+			name = "script"
+		} else if name == "" {
+			name = "<anonymous>"
+		}
+		trace = append(trace, StackFrame{name, position})
+	}
+	return trace
+}
@@ -0,0 +1,125 @@
+package lox
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// runWith runs the script with the given backend, and returns its output
+// followed by the rendered error, if any.
+func runWith(t *testing.T, backend Backend, path string, source string) string {
+	var out strings.Builder
+	i := NewInterpreter(WithBackend(backend), WithStdout(&out), WithStderr(&out))
+	if path != "" {
+		i.SetScriptPath(path)
+	}
+	if _, err := i.Eval(source, path); err != nil {
+		i.Report(err)
+	}
+	return out.String()
+}
+
+func TestBytecodeVMExamples(t *testing.T) {
+	paths, err := filepath.Glob("examples/*.lox")
+	require.NoError(t, err)
+	paths = append(paths, "examples/modules/main.lox")
+
+	for _, path := range paths {
+		t.Run(path, func(t *testing.T) {
+			b, err := ioutil.ReadFile(path)
+			require.NoError(t, err)
+			expected := runWith(t, TreeWalker, path, string(b))
+			require.Equal(t, expected, runWith(t, BytecodeVM, path, string(b)))
+		})
+	}
+}
+
+func TestBytecodeVMBehavesLikeTreeWalker(t *testing.T) {
+	scripts := []string{
+		`fun f() { try { return "a"; } finally { print "finally"; } } print f();`,
+		`for (var i = 0; i < 5; i = i + 1) {
+		   try { if (i == 1) continue; if (i == 3) break; print i; } finally { print "next"; }
+		 }`,
+		`var fs = []; for (var i = 0; i < 3; i = i + 1) { var j = i; fs.append(fun () { return j; }); }
+		 print fs[0]() + fs[1]() + fs[2]();`,
+		`try { try { throw 1; } finally { print "inner"; } } catch (e) { print e; }`,
+		`class A { init(x) { this.x = x; } m() { return "A" + this.x; } }
+		 class B < A { init() { super.init("b"); } m() { return "B" + super.m(); } }
+		 print B().m(); print B().m; print B();`,
+		`fun a() { b(); }
+		 fun b() { [].pop(); }
+		 a();`,
+		`fun f(n) { return f(n + 1); } f(0);`,
+		`print undefined;`,
+		`var x = fun () { throw "up"; }; x();`,
+		`class A {} A(1);`,
+		`class A { init() { throw "no"; } } var a = fun () { A(); }; a();`,
+		`var A = 1; class B < A {}`,
+		`try { 1 + nil; } catch (e) { print e.message; print e.line; }`,
+		`fun f() { try { return 1; } finally { return 2; } } print f();`,
+		`fun f() { while (true) { try { throw "x"; } finally { break; } } return "broke"; } print f();`,
+		`fun f() { while (true) try { throw "x"; } finally { break; } var b = "b"; var c = "c"; return b + c; } print f();`,
+		`fun f() { for (var i = 0; i < 2; i = i + 1) try { throw "x"; } finally { continue; } var b = "b"; return b; } print f();`,
+		`fun f() { while (true) try { return "r"; } finally { break; } var b = "b"; return b; } print f();`,
+		`fun t() { throw "deep"; } fun u() { t(); } try { u(); } catch (e) { print e; } u();`,
+		`var n = 0; fun inc() { n = n + 1; return n; }
+		 assert inc() == 1, inc(); print n;
+		 try { assert  n ==  2, "n is " + "one"; } catch (e) { print e.message; }
+		 assert nil;`,
+	}
+	for _, script := range scripts {
+		expected := runWith(t, TreeWalker, "test.lox", script)
+		require.Equal(t, expected, runWith(t, BytecodeVM, "test.lox", script), script)
+	}
+}
+
+func TestBytecodeVMModuleStackTraces(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"lib.lox":    "fun f() { [].pop(); }\nfun g() { f(); }\n",
+		"bad.lox":    "fun h() { nil(); }\nh();\n",
+		"nested.lox": "var x = 1;\nimport \"bad.lox\";\n",
+	}
+	for name, source := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(source), 0644))
+	}
+
+	path := filepath.Join(dir, "main.lox")
+	for _, script := range []string{
+		`import "lib.lox"; lib.g();`,
+		`import "bad.lox";`,
+		`import "nested.lox";`,
+		`import "lib.lox" for f; fun a() { f(); } a();`,
+	} {
+		expected := runWith(t, TreeWalker, path, script)
+		require.Equal(t, expected, runWith(t, BytecodeVM, path, script), script)
+
+		var traces [][]StackFrame
+		for _, backend := range []Backend{TreeWalker, BytecodeVM} {
+			i := NewInterpreter(WithBackend(backend))
+			i.SetScriptPath(path)
+			_, err := i.Eval(script, path)
+			traces = append(traces, err.(RuntimeError).StackTrace)
+		}
+		require.Equal(t, traces[0], traces[1], script)
+	}
+}
+
+func TestBytecodeVMEval(t *testing.T) {
+	i := NewInterpreter(WithBackend(BytecodeVM))
+
+	v, err := i.Eval("var a = 1; a + 2;", "")
+	require.NoError(t, err)
+	require.Equal(t, 3.0, v)
+
+	v, err = i.Eval("a * 10;", "")
+	require.NoError(t, err)
+	require.Equal(t, 10.0, v)
+
+	_, err = NewInterpreter(WithBackend(BytecodeVM), WithStepLimit(100)).Eval("while (true) {}", "")
+	require.EqualError(t, err, "Step limit exceeded.")
+}